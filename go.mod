@@ -10,6 +10,7 @@ require (
 	github.com/ydb-platform/ydb-go-sdk/v3 v3.115.0
 	github.com/ydb-platform/ydb-go-yc v0.12.3
 	github.com/ydb-platform/ydb-go-yc-metadata v0.6.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -44,7 +44,8 @@ func Handler(ctx context.Context, event interface{}) (*Response, error) {
 		return nil, err
 	}
 
-	if err = a.Run(ctx); err != nil {
+	report, err := a.Run(ctx)
+	if err != nil {
 		msg := tgbotapi.NewMessage(cfg.Telegram.ChatID, fmt.Sprintf("%s %s\n\n\n%s", cfg.App.Name, cfg.App.Version, err.Error()))
 		if _, errSend := tgClient.Send(msg); errSend != nil {
 			logger.Error(errSend.Error())
@@ -52,6 +53,13 @@ func Handler(ctx context.Context, event interface{}) (*Response, error) {
 		return nil, err
 	}
 
+	if report.NeedsAttention() {
+		msg := tgbotapi.NewMessage(cfg.Telegram.ChatID, fmt.Sprintf("%s %s\n\n\n%s", cfg.App.Name, cfg.App.Version, report.String()))
+		if _, errSend := tgClient.Send(msg); errSend != nil {
+			logger.Error(errSend.Error())
+		}
+	}
+
 	return &Response{
 		StatusCode: 200,
 		Body:       "OK",
@@ -0,0 +1,371 @@
+// Package address normalizes Russian postal addresses as ESB sends them:
+// abbreviations are made canonical ("гор.", "город" -> "г."; "ул", "улица"
+// -> "ул.") and the postal code, region, city, street and house are picked
+// out.
+package address
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go-esb-store/internal/utils"
+)
+
+// Address is a normalized address and its components. Region and Street
+// keep their type, e.g. "Московская обл." and "ул. Ленина"; City is the
+// bare name; House is the house number with its building parts, e.g.
+// "5 корп. 2". Components that were not recognized are empty.
+type Address struct {
+	Full       string
+	PostalCode string
+	Region     string
+	City       string
+	Street     string
+	House      string
+}
+
+type kind int
+
+const (
+	other kind = iota
+	region
+	district
+	locality
+	street
+	house
+	building
+	premises
+)
+
+type abbr struct {
+	canonical string
+	kind      kind
+}
+
+// abbrs maps the spellings of address element types, lower case and
+// without the trailing dot, to their canonical abbreviation.
+var abbrs = map[string]abbr{
+	"область":    {"обл.", region},
+	"обл":        {"обл.", region},
+	"край":       {"край", region},
+	"республика": {"респ.", region},
+	"респ":       {"респ.", region},
+	"ао":         {"АО", region},
+
+	"район": {"р-н", district},
+	"р-н":   {"р-н", district},
+	"р-он":  {"р-н", district},
+
+	"город":   {"г.", locality},
+	"гор":     {"г.", locality},
+	"г":       {"г.", locality},
+	"поселок": {"пос.", locality},
+	"посёлок": {"пос.", locality},
+	"пос":     {"пос.", locality},
+	"пгт":     {"пгт", locality},
+	"село":    {"с.", locality},
+	"с":       {"с.", locality},
+	"деревня": {"дер.", locality},
+	"дер":     {"дер.", locality},
+	"станица": {"ст-ца", locality},
+	"ст-ца":   {"ст-ца", locality},
+
+	"улица":      {"ул.", street},
+	"ул":         {"ул.", street},
+	"проспект":   {"просп.", street},
+	"просп":      {"просп.", street},
+	"пр-кт":      {"просп.", street},
+	"пр-т":       {"просп.", street},
+	"пр":         {"просп.", street},
+	"переулок":   {"пер.", street},
+	"пер":        {"пер.", street},
+	"шоссе":      {"ш.", street},
+	"ш":          {"ш.", street},
+	"бульвар":    {"б-р", street},
+	"б-р":        {"б-р", street},
+	"бул":        {"б-р", street},
+	"набережная": {"наб.", street},
+	"наб":        {"наб.", street},
+	"площадь":    {"пл.", street},
+	"пл":         {"пл.", street},
+	"проезд":     {"пр-д", street},
+	"пр-д":       {"пр-д", street},
+	"микрорайон": {"мкр.", street},
+	"мкр":        {"мкр.", street},
+	"мкрн":       {"мкр.", street},
+	"мк-н":       {"мкр.", street},
+	"тракт":      {"тракт", street},
+	"аллея":      {"аллея", street},
+	"тупик":      {"туп.", street},
+	"туп":        {"туп.", street},
+	"квартал":    {"кв-л", street},
+	"кв-л":       {"кв-л", street},
+
+	"дом":      {"д.", house},
+	"д":        {"д.", house},
+	"владение": {"вл.", house},
+	"вл":       {"вл.", house},
+
+	"корпус":   {"корп.", building},
+	"корп":     {"корп.", building},
+	"к":        {"корп.", building},
+	"строение": {"стр.", building},
+	"стр":      {"стр.", building},
+	"литера":   {"лит.", building},
+	"лит":      {"лит.", building},
+
+	"помещение": {"пом.", premises},
+	"пом":       {"пом.", premises},
+	"офис":      {"оф.", premises},
+	"оф":        {"оф.", premises},
+	"этаж":      {"эт.", premises},
+	"эт":        {"эт.", premises},
+}
+
+// countries are dropped from the address.
+var countries = map[string]struct{}{
+	"россия": {},
+	"рф":     {},
+	"российская федерация": {},
+	"russia": {},
+}
+
+// federalCities are cities that are regions of their own.
+var federalCities = map[string]struct{}{
+	"Москва":          {},
+	"Санкт-Петербург": {},
+	"Севастополь":     {},
+}
+
+// segment is one address element: an optional type and a name.
+type segment struct {
+	abbr   *abbr
+	prefix bool
+	words  []string
+}
+
+func (s *segment) name() string {
+	return strings.Join(s.words, " ")
+}
+
+func (s *segment) String() string {
+	switch {
+	case s.abbr == nil:
+		return s.name()
+	case s.prefix:
+		return s.abbr.canonical + " " + s.name()
+	default:
+		return s.name() + " " + s.abbr.canonical
+	}
+}
+
+// Parse normalizes a raw address and splits it into components.
+func Parse(raw string) Address {
+	s := strings.Join(strings.Fields(utils.CleanString(raw)), " ")
+
+	var a Address
+	a.PostalCode, s = cutPostalCode(s)
+
+	var segments []*segment
+	for _, part := range strings.Split(s, ",") {
+		part = strings.Trim(part, " ;")
+		if part == "" {
+			continue
+		}
+		if _, ok := countries[strings.ToLower(part)]; ok {
+			continue
+		}
+		segments = append(segments, split(tokens(part))...)
+	}
+
+	full := make([]string, 0, len(segments)+1)
+	if a.PostalCode != "" {
+		full = append(full, a.PostalCode)
+	}
+	for _, seg := range segments {
+		a.classify(seg)
+		if len(seg.words) > 0 {
+			full = append(full, seg.String())
+		}
+	}
+	a.Full = strings.Join(full, ", ")
+
+	if _, ok := federalCities[a.City]; ok && a.Region == "" {
+		a.Region = a.City
+	}
+
+	return a
+}
+
+// classify stores seg in its component, typing an untyped house number.
+func (a *Address) classify(seg *segment) {
+	if len(seg.words) == 0 {
+		return
+	}
+
+	if seg.abbr == nil {
+		switch name := seg.name(); {
+		case a.House == "" && (a.Street != "" || a.City != "") && startsWithDigit(name):
+			seg.abbr, seg.prefix = &abbr{"д.", house}, true
+		case a.City == "" && isFederalCity(name):
+			seg.abbr, seg.prefix = &abbr{"г.", locality}, true
+		default:
+			return
+		}
+	}
+
+	switch seg.abbr.kind {
+	case region:
+		if a.Region == "" {
+			a.Region = seg.String()
+		}
+	case locality:
+		if a.City == "" {
+			a.City = seg.name()
+		}
+	case street:
+		if a.Street == "" {
+			a.Street = seg.String()
+		}
+	case house:
+		if a.House == "" {
+			a.House = seg.name()
+		}
+	case building:
+		if a.House != "" {
+			a.House += " " + seg.String()
+		}
+	}
+}
+
+// cutPostalCode removes the first standalone six digit number, the Russian
+// postal code, from s.
+func cutPostalCode(s string) (string, string) {
+	runes := []rune(s)
+	for i := 0; i+6 <= len(runes); i++ {
+		if i > 0 && unicode.IsDigit(runes[i-1]) {
+			continue
+		}
+		if i+6 < len(runes) && (unicode.IsDigit(runes[i+6]) || unicode.IsLetter(runes[i+6])) {
+			continue
+		}
+		digits := true
+		for _, r := range runes[i : i+6] {
+			if !unicode.IsDigit(r) {
+				digits = false
+				break
+			}
+		}
+		if digits {
+			rest := strings.Trim(string(runes[:i])+" "+string(runes[i+6:]), " ,")
+			return string(runes[i : i+6]), strings.Join(strings.Fields(rest), " ")
+		}
+	}
+	return "", s
+}
+
+// tokens splits a part into words, separating types glued to their value,
+// as in "г.Москва" or "д5".
+func tokens(part string) []string {
+	var out []string
+	for _, w := range strings.Fields(part) {
+		if head, tail, ok := strings.Cut(w, "."); ok && tail != "" {
+			if _, isAbbr := lookup(head); isAbbr {
+				out = append(out, head+".", tail)
+				continue
+			}
+		}
+		if i := strings.IndexFunc(w, unicode.IsDigit); i > 0 {
+			if a, isAbbr := lookup(w[:i]); isAbbr && (a.kind == house || a.kind == building) {
+				out = append(out, w[:i], w[i:])
+				continue
+			}
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+// split groups the words of a part into segments. A type starts a new
+// segment, or ends the current one when it follows the name, as in
+// "Московская обл." or "Ленина ул".
+func split(words []string) []*segment {
+	var (
+		out []*segment
+		cur = &segment{}
+	)
+	flush := func() {
+		if cur.abbr != nil || len(cur.words) > 0 {
+			out = append(out, cur)
+		}
+		cur = &segment{}
+	}
+
+	for i, w := range words {
+		a, ok := lookup(w)
+		if ok && !isType(w, a, words, i) {
+			ok = false
+		}
+		if !ok {
+			// A number after a street or locality name is the house, as in
+			// "ул. Баумана 10".
+			if cur.abbr != nil && (cur.abbr.kind == street || cur.abbr.kind == locality) && len(cur.words) > 0 && startsWithDigit(w) {
+				flush()
+			}
+			cur.words = append(cur.words, w)
+			continue
+		}
+
+		last := i == len(words)-1
+		if cur.abbr == nil && len(cur.words) > 0 {
+			if _, nextIsType := lookup(next(words, i)); last || nextIsType {
+				cur.abbr = &a
+				flush()
+				continue
+			}
+		}
+
+		flush()
+		cur.abbr, cur.prefix = &a, true
+	}
+	flush()
+
+	return out
+}
+
+// isType tells a type from a name word that reads like one, e.g. the
+// initial in "ул. К. Маркса": single letter types must be lower case or
+// start the part, and house and building types need a number after them.
+func isType(w string, a abbr, words []string, i int) bool {
+	if (a.kind == house || a.kind == building) && !startsWithDigit(next(words, i)) {
+		return false
+	}
+	base := strings.TrimSuffix(w, ".")
+	if utf8.RuneCountInString(base) == 1 && i > 0 && strings.ToLower(base) != base {
+		return false
+	}
+	return true
+}
+
+func lookup(w string) (abbr, bool) {
+	a, ok := abbrs[strings.ToLower(strings.TrimSuffix(w, "."))]
+	return a, ok
+}
+
+func next(words []string, i int) string {
+	if i+1 < len(words) {
+		return words[i+1]
+	}
+	return ""
+}
+
+func startsWithDigit(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsDigit(r)
+}
+
+func isFederalCity(name string) bool {
+	_, ok := federalCities[name]
+	return ok
+}
@@ -0,0 +1,109 @@
+package address
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want Address
+	}{
+		{
+			name: "canonical",
+			raw:  "г. Казань, ул. Баумана, д. 10",
+			want: Address{Full: "г. Казань, ул. Баумана, д. 10", City: "Казань", Street: "ул. Баумана", House: "10"},
+		},
+		{
+			name: "full type names",
+			raw:  "город Казань, улица Баумана, дом 10",
+			want: Address{Full: "г. Казань, ул. Баумана, д. 10", City: "Казань", Street: "ул. Баумана", House: "10"},
+		},
+		{
+			name: "glued types",
+			raw:  "г.Москва, ул.Тверская, д5",
+			want: Address{Full: "г. Москва, ул. Тверская, д. 5", Region: "Москва", City: "Москва", Street: "ул. Тверская", House: "5"},
+		},
+		{
+			name: "postfix types",
+			raw:  "Казань г, Ленина ул, 5",
+			want: Address{Full: "Казань г., Ленина ул., д. 5", City: "Казань", Street: "Ленина ул.", House: "5"},
+		},
+		{
+			name: "postfix region",
+			raw:  "Московская область, г. Химки, Ленинградское шоссе, вл. 16",
+			want: Address{Full: "Московская обл., г. Химки, Ленинградское ш., вл. 16", Region: "Московская обл.", City: "Химки", Street: "Ленинградское ш.", House: "16"},
+		},
+		{
+			name: "initials",
+			raw:  "г. Новосибирск, ул. К. Маркса, д. 3",
+			want: Address{Full: "г. Новосибирск, ул. К. Маркса, д. 3", City: "Новосибирск", Street: "ул. К. Маркса", House: "3"},
+		},
+		{
+			name: "federal city without type",
+			raw:  "Санкт-Петербург, Невский пр-кт, 28",
+			want: Address{Full: "г. Санкт-Петербург, Невский просп., д. 28", Region: "Санкт-Петербург", City: "Санкт-Петербург", Street: "Невский просп.", House: "28"},
+		},
+		{
+			name: "federal city keeps its region",
+			raw:  "г. Севастополь, ул. Ленина, д. 1",
+			want: Address{Full: "г. Севастополь, ул. Ленина, д. 1", Region: "Севастополь", City: "Севастополь", Street: "ул. Ленина", House: "1"},
+		},
+		{
+			name: "postal code",
+			raw:  "420111, г. Казань, ул. Баумана, д. 10",
+			want: Address{Full: "420111, г. Казань, ул. Баумана, д. 10", PostalCode: "420111", City: "Казань", Street: "ул. Баумана", House: "10"},
+		},
+		{
+			name: "postal code at the end",
+			raw:  "г. Казань, ул. Баумана, д. 10, 420111",
+			want: Address{Full: "420111, г. Казань, ул. Баумана, д. 10", PostalCode: "420111", City: "Казань", Street: "ул. Баумана", House: "10"},
+		},
+		{
+			name: "country",
+			raw:  "Россия, 420111, г. Казань, ул. Баумана, д. 10",
+			want: Address{Full: "420111, г. Казань, ул. Баумана, д. 10", PostalCode: "420111", City: "Казань", Street: "ул. Баумана", House: "10"},
+		},
+		{
+			name: "building parts",
+			raw:  "г. Москва, ул. Тверская, д. 5, корп. 2, стр. 1",
+			want: Address{Full: "г. Москва, ул. Тверская, д. 5, корп. 2, стр. 1", Region: "Москва", City: "Москва", Street: "ул. Тверская", House: "5 корп. 2 стр. 1"},
+		},
+		{
+			name: "glued building parts",
+			raw:  "г. Москва, ул. Тверская, д5 к2",
+			want: Address{Full: "г. Москва, ул. Тверская, д. 5, корп. 2", Region: "Москва", City: "Москва", Street: "ул. Тверская", House: "5 корп. 2"},
+		},
+		{
+			name: "house after street name",
+			raw:  "г. Казань, ул. Баумана 10",
+			want: Address{Full: "г. Казань, ул. Баумана, д. 10", City: "Казань", Street: "ул. Баумана", House: "10"},
+		},
+		{
+			name: "premises are kept but not parsed",
+			raw:  "г. Казань, ул. Баумана, д. 10, пом. 3",
+			want: Address{Full: "г. Казань, ул. Баумана, д. 10, пом. 3", City: "Казань", Street: "ул. Баумана", House: "10"},
+		},
+		{
+			name: "extra spaces",
+			raw:  "  г.  Казань ,  ул.   Баумана ,, д. 10 ",
+			want: Address{Full: "г. Казань, ул. Баумана, д. 10", City: "Казань", Street: "ул. Баумана", House: "10"},
+		},
+		{
+			name: "unrecognized",
+			raw:  "ТЦ Радуга",
+			want: Address{Full: "ТЦ Радуга"},
+		},
+		{
+			name: "empty",
+			raw:  "",
+			want: Address{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.raw); got != tt.want {
+				t.Errorf("Parse(%q) =\n%+v\nwant\n%+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
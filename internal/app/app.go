@@ -2,9 +2,13 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
+	"go-esb-store/internal/address"
+	"go-esb-store/internal/archive"
 	"go-esb-store/internal/config"
 	"go-esb-store/internal/esb"
 	"go-esb-store/internal/model"
@@ -13,148 +17,409 @@ import (
 	"go-esb-store/pkg/logger"
 )
 
+// syncStateName keys the stores sync in the sync state table.
+const syncStateName = "stores"
+
+// storage is what a run reads from and writes to YDB; *ydb.Client
+// implements it.
+type storage interface {
+	GetSyncState(ctx context.Context, name string) (*model.SyncState, error)
+	SetSyncState(ctx context.Context, state *model.SyncState) error
+	SetStores(ctx context.Context, stores []model.Store) error
+	DeleteStoresNotSyncedSince(ctx context.Context, since time.Time, countries []string, keep []model.StoreKey) error
+	SetRejections(ctx context.Context, runAt time.Time, rejections []model.Rejection) error
+	UpsertRows(ctx context.Context, t *ydb.Table, rows []ydb.Row) error
+	DeleteRowsNotSyncedSince(ctx context.Context, t *ydb.Table, since time.Time, keep []ydb.Row) error
+	GetDictionary(ctx context.Context, d ydb.Dictionary) (map[string]model.DictionaryEntry, error)
+}
+
 type App struct {
-	esb *esb.ClientWithDefaults
-	ydb *ydb.Client
+	esb              *esb.ClientWithDefaults
+	ydb              storage
+	archive          *archive.Archiver
+	drift            *esb.DriftDetector
+	syncMode         model.SyncMode
+	fullSyncInterval time.Duration
+	deleteStale      bool
+	countries        []string
+	entities         []*Entity
+	maxRejected      int
+	duplicatePolicy  model.DuplicatePolicy
+	mapping          *Mapping
+	// dryRun leaves YDB untouched, see dryRunStorage.
+	dryRun bool
 }
 
 func New(ctx context.Context, cfg *config.Config) (*App, error) {
-	logger.Debug("app.New: init esb client")
-	esbClient, err := esb.NewESBClient(&cfg.ESB)
+	a, tables, err := newApp(cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	// A replay never connects to YDB: it reads the state recorded with the
+	// ESB responses.
+	mode := esb.CassetteMode(cfg.ESB.CassetteMode)
+	if mode == esb.CassetteReplay {
+		logger.Debug("app.New: load recorded ydb state", "dir", cfg.ESB.CassetteDir)
+		mem, err := loadCassetteStorage(cfg.ESB.CassetteDir)
+		if err != nil {
+			return nil, err
+		}
+		a.setStorage(mem)
+		return a, nil
+	}
+
 	logger.Debug("app.New: init ydb client")
-	ydbClient, err := ydb.NewYDBClient(ctx, &cfg.YDB)
+	ydbClient, err := ydb.NewYDBClient(ctx, &cfg.YDB, tables...)
 	if err != nil {
 		return nil, err
 	}
+	if mode == esb.CassetteRecord {
+		a.setStorage(newRecordStorage(ydbClient, cfg.ESB.CassetteDir))
+	} else {
+		a.setStorage(ydbClient)
+	}
 
-	return &App{
-		esb: esbClient,
-		ydb: ydbClient,
-	}, nil
+	return a, nil
 }
 
-func (a *App) Run(ctx context.Context) error {
-	rawStores, err := a.esb.GetStores(ctx)
+// newApp sets up everything but YDB from cfg and returns the tables of the
+// configured entities, which the YDB client creates in dev mode.
+func newApp(cfg *config.Config) (*App, []*ydb.Table, error) {
+	if cfg.App.SyncMode != model.FullSync && cfg.App.SyncMode != model.DeltaSync {
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnsupportedSyncMode, cfg.App.SyncMode)
+	}
+	switch cfg.App.DuplicatePolicy {
+	case model.PreferOpen, model.PreferComplete, model.FailOnDuplicate:
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnsupportedDuplicatePolicy, cfg.App.DuplicatePolicy)
+	}
+	// A filtered run does not see the stores outside the filter, so it
+	// would delete them.
+	if cfg.App.DeleteStale && cfg.ESB.Filter != "" {
+		return nil, nil, fmt.Errorf("%w: unset APP_DELETE_STALE or ESB_FILTER", ErrDeleteWithFilter)
+	}
+
+	logger.Debug("app.New: load store mapping", "file", cfg.App.MappingFile)
+	mapping, err := LoadMapping(cfg.App.MappingFile)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	stores := make([]model.Store, 0, len(rawStores))
-	for i, rs := range rawStores {
-		s, e := a.rawToModelStore(rs)
-		if e != nil {
-			logger.Error("app.Run: failed to convert raw store", "error", e, "store", rs, "index", i)
-			continue
+	logger.Debug("app.New: load entities", "file", cfg.App.EntitiesFile)
+	entities, err := LoadEntities(cfg.App.EntitiesFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		syncEntities []*Entity
+		tables       []*ydb.Table
+	)
+	for _, name := range cfg.App.Entities {
+		e, ok := entities[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %q", ErrUnsupportedEntity, name)
 		}
-		stores = append(stores, *s)
+		syncEntities = append(syncEntities, e)
+		tables = append(tables, e.table())
 	}
 
-	if err = a.ydb.SetStores(ctx, stores); err != nil {
-		return err
+	logger.Debug("app.New: init esb client")
+	esbClient, err := esb.NewESBClient(&cfg.ESB, mapping.Sources())
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return nil
+	logger.Debug("app.New: init archive")
+	arch, err := archive.New(&cfg.Archive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Debug("app.New: init schema drift detector")
+	drift, err := esb.NewDriftDetector()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pageHooks := []func(ctx context.Context, page int, body []byte){drift.Page}
+	if arch != nil {
+		pageHooks = append(pageHooks, arch.Page)
+		logger.Info("app.New: archiving ESB pages", "backend", cfg.Archive.Backend, "run", arch.RunID())
+	}
+	// Without the sample, $select would hide the fields ESB added.
+	esbClient.DriftSample = true
+	esbClient.OnPageBody = func(ctx context.Context, page int, body []byte) {
+		for _, hook := range pageHooks {
+			hook(ctx, page, body)
+		}
+	}
+
+	return &App{
+		esb:              esbClient,
+		archive:          arch,
+		drift:            drift,
+		syncMode:         cfg.App.SyncMode,
+		fullSyncInterval: cfg.App.FullSyncInterval,
+		deleteStale:      cfg.App.DeleteStale,
+		countries:        cfg.ESB.Countries,
+		entities:         syncEntities,
+		maxRejected:      cfg.App.MaxRejected,
+		duplicatePolicy:  cfg.App.DuplicatePolicy,
+		mapping:          mapping,
+		dryRun:           esb.CassetteMode(cfg.ESB.CassetteMode) == esb.CassetteReplay,
+	}, tables, nil
 }
 
-func (a *App) rawToModelStore(rawStore esb.Store) (*model.Store, error) {
-	store := &model.Store{}
+// setStorage makes s the storage of the app. A dry run only reads from it.
+func (a *App) setStorage(s storage) {
+	if a.dryRun {
+		logger.Info("app.setStorage: dry run, YDB is not written")
+		s = dryRunStorage{s}
+	}
+	a.ydb = s
+}
 
-	// Must: Store number
-	if rawStore.StoreFactsNumber == nil {
-		logger.Error("service.rawToModelStore: invalid store facts number (nil)", "rawStore", rawStore)
-		return nil, ErrInvalidStoreFactsNumber
+// Run syncs stores and then the configured entities from ESB to YDB. A
+// delta run only fetches stores modified since the saved watermark; a full
+// run fetches all of them and, with APP_DELETE_STALE, then deletes the
+// stores it did not see. The watermark only moves after a complete run;
+// failed pages in partial mode leave the run incomplete, see Report.
+// Stores that fail conversion are saved to the rejected stores table, are
+// never deleted and hold the watermark back so that the next delta run
+// fetches them again; more than APP_MAX_REJECTED of them fail the run
+// before anything is deleted. Records sharing a store number are resolved
+// by APP_DUPLICATE_POLICY; the fail policy fails the run after the pages
+// are upserted, before deletion and the watermark. Brand and format codes not
+// in their dictionaries, or inactive there, are reported but do not fail
+// the run.
+func (a *App) Run(ctx context.Context) (*Report, error) {
+	runStart := time.Now()
+
+	report := &Report{}
+	if a.archive != nil {
+		report.RunID = a.archive.RunID()
+	}
+	defer a.cleanupArchive(ctx)
+
+	if err := a.syncStores(ctx, runStart, report); err != nil {
+		return nil, err
 	}
-	numStr := utils.CleanString(*rawStore.StoreFactsNumber)
-	if numStr == "" {
-		logger.Warn("service.rawToModelStore: empty store facts number", "rawStore", rawStore)
-		return nil, ErrEmptyStoreFactsNumber
+
+	for _, e := range a.entities {
+		if err := a.syncEntity(ctx, e, runStart, report); err != nil {
+			return nil, err
+		}
 	}
-	number, err := strconv.Atoi(numStr)
+
+	return report, nil
+}
+
+func (a *App) syncStores(ctx context.Context, runStart time.Time, report *Report) error {
+	state, err := a.ydb.GetSyncState(ctx, syncStateName)
 	if err != nil {
-		logger.Error("service.rawToModelStore: error parsing store facts number", "error", err, "value", numStr, "rawStore", rawStore)
-		return nil, fmt.Errorf("%w: %q", ErrParseStoreFactsNumber, numStr)
+		return err
 	}
-	store.Number = number
 
-	// Must: Name
-	if rawStore.NameAlias == nil {
-		logger.Error("service.rawToModelStore: invalid store name alias (nil)", "rawStore", rawStore)
-		return nil, ErrInvalidStoreName
+	client, full := a.esb, a.fullSyncDue(state, runStart)
+	if !full {
+		client = a.esb.ModifiedSince(state.Watermark)
 	}
-	if name := utils.CleanString(*rawStore.NameAlias); name == "" {
-		logger.Error("service.rawToModelStore: invalid store name alias (empty)", "rawStore", rawStore)
-		return nil, ErrInvalidStoreName
-	} else {
-		store.Name = name
+	logger.Info("app.syncStores: sync started", "full", full, "watermark", state.Watermark, "lastFullSync", state.FullSyncAt)
+	report.Full = full
+
+	var (
+		watermark = state.Watermark
+		// rejectedFrom is the earliest modification of a rejected store.
+		rejectedFrom time.Time
+		rejectedKeys []model.StoreKey
+	)
+	stores := newDedup(a.duplicatePolicy)
+	check, err := a.newCodeCheck(ctx)
+	if err != nil {
+		return err
+	}
+	for rawStores, err := range client.StorePages(ctx) {
+		var pageErr *esb.PageError
+		if errors.As(err, &pageErr) {
+			logger.Warn("app.syncStores: skipping failed page", "error", pageErr, "page", pageErr.Page)
+			report.FailedPages = append(report.FailedPages, pageErr.Page)
+			continue
+		}
+		if err != nil {
+			// A changed field type fails decoding, so the drift explains it.
+			if drift := a.drift.Drift(); !drift.Empty() {
+				err = fmt.Errorf("%w\n\n%s", err, drift)
+			}
+			return err
+		}
+
+		page := make([]model.Store, 0, len(rawStores))
+		index := make(map[storeKey]int, len(rawStores))
+		for i, rs := range rawStores {
+			t := modifiedAt(rs)
+
+			s, e := a.rawToModelStore(rs)
+			if e != nil {
+				logger.Error("app.syncStores: failed to convert raw store", "error", e, "store", rs, "index", i)
+				report.Rejected = append(report.Rejected, newRejection(rs, e))
+				if key, ok := rawKey(rs); ok {
+					rejectedKeys = append(rejectedKeys, key)
+				}
+				if !t.IsZero() && (rejectedFrom.IsZero() || t.Before(rejectedFrom)) {
+					rejectedFrom = t
+				}
+				continue
+			}
+			if t.After(watermark) {
+				watermark = t
+			}
+			s.SyncedAt = runStart
+
+			keep, conflict := stores.add(*s)
+			if conflict != nil {
+				logger.Warn("app.syncStores: duplicate store number", "conflict", conflict.String(), "policy", a.duplicatePolicy)
+				report.Conflicts = append(report.Conflicts, *conflict)
+			}
+			if keep {
+				page = putStore(page, index, *s)
+				check.add(*s)
+			}
+		}
+
+		// A store kept over one of an earlier page overwrites it here.
+		if err = a.ydb.SetStores(ctx, page); err != nil {
+			return err
+		}
 	}
+	report.Synced = stores.count()
 
-	// Must: Address
-	if rawStore.PrimaryAddress == nil {
-		logger.Error("service.rawToModelStore: invalid primary address (nil)", "rawStore", rawStore)
-		return nil, ErrInvalidStoreAddress
+	if report.Drift = a.drift.Drift(); !report.Drift.Empty() {
+		logger.Warn("app.syncStores: ESB schema drift detected", "drift", report.Drift.String())
 	}
-	if addr := utils.CleanString(*rawStore.PrimaryAddress); addr == "" {
-		logger.Error("service.rawToModelStore: invalid primary address (empty)", "rawStore", rawStore)
-		return nil, ErrInvalidStoreAddress
-	} else {
-		store.Address = addr
+
+	if len(report.Rejected) > 0 {
+		logger.Warn("app.syncStores: stores rejected", "count", len(report.Rejected), "max", a.maxRejected)
+		if err = a.ydb.SetRejections(ctx, runStart, report.Rejected); err != nil {
+			return err
+		}
+	}
+	if a.maxRejected > 0 && len(report.Rejected) > a.maxRejected {
+		return fmt.Errorf("%w: %d, max %d\n\n%s", ErrTooManyRejected, len(report.Rejected), a.maxRejected, rejectedSummary(storesEntity, report.Rejected))
 	}
 
-	// Optional: Mall
-	if rawStore.FacilityShoppingCenterName != nil {
-		store.Mall = utils.CleanString(*rawStore.FacilityShoppingCenterName)
-	} else {
-		store.Mall = ""
+	if report.UnknownCodes = check.codes(); len(report.UnknownCodes) > 0 {
+		logger.Warn("app.syncStores: stores with unknown codes", "summary", report.unknownCodesSummary())
 	}
 
-	// Optional: Franchise
-	if rawStore.FranchiseePartnerName != nil && *rawStore.FranchiseePartnerName != "" {
-		store.Franchise = utils.CleanString(*rawStore.FranchiseePartnerName)
-	} else {
-		logger.Debug("service.rawToModelStore: empty store franchise", "rawStore", rawStore)
-		store.Franchise = ""
+	// The first record of each number is upserted by then, but the run
+	// neither deletes stale stores nor moves the watermark.
+	if a.duplicatePolicy == model.FailOnDuplicate && len(report.Conflicts) > 0 {
+		return fmt.Errorf("%w: %d\n\n%s", ErrDuplicateStores, len(report.Conflicts), report.conflictsSummary())
 	}
 
-	// Optional: Brand
-	if rawStore.BrandId != nil && *rawStore.BrandId != "" {
-		store.Brand = utils.CleanString(*rawStore.BrandId)
-	} else {
-		logger.Debug("service.rawToModelStore: empty store brand", "rawStore", rawStore)
-		store.Brand = ""
+	if len(report.FailedPages) > 0 {
+		logger.Warn("app.syncStores: incomplete sync, skipping deletions and sync state update", "count", report.Synced, "failedPages", report.FailedPages)
+		return nil
 	}
 
-	// Optional: Format
-	if rawStore.StoreFormatId != nil && *rawStore.StoreFormatId != "" {
-		store.Format = utils.CleanString(*rawStore.StoreFormatId)
-	} else {
-		logger.Debug("service.rawToModelStore: empty store format", "rawStore", rawStore)
-		store.Format = ""
-	}
-
-	// Optional: Status
-	if rawStore.Status != nil && *rawStore.Status != "" {
-		switch *rawStore.Status {
-		case esb.Dead:
-			store.Status = model.Dead
-		case esb.Closed:
-			store.Status = model.Closed
-		case esb.Refranchised:
-			store.Status = model.Refranchised
-		case esb.Open:
-			store.Status = model.Open
-		case esb.New:
-			store.Status = model.New
-		case esb.PreOpening:
-			store.Status = model.PreOpening
-		default:
-			logger.Warn("service.rawToModelStore: invalid store status", "rawStore", rawStore)
-			store.Status = model.Undefined
+	if full {
+		if a.deleteStale {
+			// Rejected stores are not synced, but they are not gone from ESB.
+			if err = a.ydb.DeleteStoresNotSyncedSince(ctx, runStart, a.countries, rejectedKeys); err != nil {
+				return err
+			}
 		}
+		state.FullSyncAt = runStart
+	}
+	if !rejectedFrom.IsZero() && rejectedFrom.Before(watermark) {
+		logger.Warn("app.syncStores: holding the watermark back at the earliest rejected store", "watermark", rejectedFrom, "fetched", watermark)
+		watermark = rejectedFrom
 	}
+	state.Watermark = watermark
+	if err = a.ydb.SetSyncState(ctx, state); err != nil {
+		return err
+	}
+
+	logger.Info("app.syncStores: stores synced", "count", report.Synced, "full", full, "watermark", watermark)
+	return nil
+}
+
+// cleanupArchive drops archived pages past their retention. A failed
+// cleanup does not fail the run.
+func (a *App) cleanupArchive(ctx context.Context) {
+	if a.archive == nil {
+		return
+	}
+
+	deleted, err := a.archive.Cleanup(ctx)
+	if err != nil {
+		logger.Error("app.cleanupArchive: failed to clean up archive", "error", err, "deleted", deleted)
+		return
+	}
+	logger.Debug("app.cleanupArchive: archive cleaned up", "deleted", deleted)
+}
+
+// fullSyncDue reports whether this run has to fetch the whole catalogue:
+// always in full mode, and in delta mode when there is no watermark yet or
+// the last full run is older than the full sync interval.
+func (a *App) fullSyncDue(state *model.SyncState, now time.Time) bool {
+	if a.syncMode == model.FullSync || state.Watermark.IsZero() {
+		return true
+	}
+	return a.fullSyncInterval > 0 && now.Sub(state.FullSyncAt) >= a.fullSyncInterval
+}
+
+// modifiedAt returns the ESB modification time of a store, or zero if it is
+// missing or unparsable.
+func modifiedAt(rawStore esb.Store) time.Time {
+	if rawStore.ModifiedDateTime == nil {
+		return time.Time{}
+	}
+
+	t, err := utils.ParseTimeString(utils.CleanString(*rawStore.ModifiedDateTime))
+	if err != nil {
+		logger.Warn("app.modifiedAt: invalid store modified date", "error", err, "rawStore", rawStore)
+		return time.Time{}
+	}
+
+	return t
+}
+
+// rawKey returns the key of an ESB store as the mapping would convert it,
+// or false if its number is not a number.
+func rawKey(rawStore esb.Store) (model.StoreKey, bool) {
+	if rawStore.StoreFactsNumber == nil {
+		return model.StoreKey{}, false
+	}
+	number, err := strconv.Atoi(utils.CleanString(*rawStore.StoreFactsNumber))
+	if err != nil {
+		return model.StoreKey{}, false
+	}
+
+	var country string
+	if rawStore.PrimaryCountryRegionId != nil {
+		country = utils.CleanString(*rawStore.PrimaryCountryRegionId)
+	}
+	return model.StoreKey{Country: country, Number: number}, true
+}
+
+// rawToModelStore converts an ESB store with the mapping and parses its
+// address into components.
+func (a *App) rawToModelStore(rawStore esb.Store) (*model.Store, error) {
+	store, err := a.mapping.Apply(rawStore)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := address.Parse(store.Address)
+	store.NormalizedAddress = addr.Full
+	store.PostalCode = addr.PostalCode
+	store.AddressRegion = addr.Region
+	store.AddressCity = addr.City
+	store.Street = addr.Street
+	store.House = addr.House
 
 	return store, nil
 }
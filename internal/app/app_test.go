@@ -0,0 +1,370 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"go-esb-store/internal/esb/esbtest"
+	"go-esb-store/internal/model"
+	"go-esb-store/internal/ydb"
+)
+
+// newTestApp returns an App syncing from srv into an in-memory storage
+// whose dictionaries hold the codes of the esbtest fixtures.
+func newTestApp(t *testing.T, srv *esbtest.Server, environment map[string]string) (*App, *memStorage) {
+	t.Helper()
+
+	vars := map[string]string{
+		"ESB_BASE_URL":       srv.URL,
+		"ESB_API_KEY":        "key",
+		"ESB_COUNTRIES":      "RUS,KAZ",
+		"ESB_RETRY_ATTEMPTS": "1",
+	}
+	maps.Copy(vars, environment)
+
+	a, _, err := newApp(testConfig(t, vars))
+	if err != nil {
+		t.Fatalf("newApp() error = %v", err)
+	}
+
+	mem := newMemStorage()
+	a.setStorage(mem)
+	for d, codes := range map[ydb.Dictionary][]string{
+		ydb.Brands:  {"FIX", "FIXP", "FIXH"},
+		ydb.Formats: {"STD", "MINI", "MALL", "STREET"},
+	} {
+		mem.dicts[d] = make(map[string]model.DictionaryEntry, len(codes))
+		for i, code := range codes {
+			mem.dicts[d][code] = model.DictionaryEntry{Code: code, Name: code, Active: true, SortOrder: i}
+		}
+	}
+
+	return a, mem
+}
+
+// maxModified returns the latest ModifiedDateTime of the fixtures.
+func maxModified(t *testing.T, fixtures []map[string]any) time.Time {
+	t.Helper()
+
+	var latest time.Time
+	for _, f := range fixtures {
+		m, err := time.Parse(time.RFC3339, f["ModifiedDateTime"].(string))
+		if err != nil {
+			t.Fatalf("fixture ModifiedDateTime: %v", err)
+		}
+		if m.After(latest) {
+			latest = m
+		}
+	}
+	return latest
+}
+
+func TestRunFullSync(t *testing.T) {
+	fixtures := append(esbtest.Stores("RUS", 1, 250), esbtest.Stores("KAZ", 1, 30)...)
+	srv := esbtest.NewServer(fixtures)
+	defer srv.Close()
+
+	a, mem := newTestApp(t, srv, map[string]string{"APP_DELETE_STALE": "true"})
+	earlier := time.Now().Add(-24 * time.Hour)
+	mem.stores[storeKey{"RUS", 9999}] = model.Store{Number: 9999, Country: "RUS", SyncedAt: earlier}
+	mem.stores[storeKey{"BLR", 1}] = model.Store{Number: 1, Country: "BLR", SyncedAt: earlier}
+
+	report, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if !report.Full || report.Synced != len(fixtures) {
+		t.Errorf("report = full %t, %d synced, want full, %d synced", report.Full, report.Synced, len(fixtures))
+	}
+	if _, ok := mem.stores[storeKey{"RUS", 9999}]; ok {
+		t.Error("store gone from ESB was not deleted")
+	}
+	if _, ok := mem.stores[storeKey{"BLR", 1}]; !ok {
+		t.Error("store of a country not synced was deleted")
+	}
+	if len(mem.stores) != len(fixtures)+1 {
+		t.Errorf("stored %d stores, want %d", len(mem.stores), len(fixtures)+1)
+	}
+
+	s := mem.stores[storeKey{"KAZ", 2}]
+	if s.Name != "Магазин 2" || s.AddressCity != "Астана" || s.ESBCity != "г. Астана" {
+		t.Errorf("store KAZ 2 = %+v", s)
+	}
+
+	state := mem.states[syncStateName]
+	if want := maxModified(t, fixtures); !state.Watermark.Equal(want) {
+		t.Errorf("watermark = %s, want %s", state.Watermark, want)
+	}
+	if state.FullSyncAt.IsZero() {
+		t.Error("full sync time not saved")
+	}
+}
+
+func TestRunDeltaSync(t *testing.T) {
+	fixtures := esbtest.Stores("RUS", 1, 120)
+	srv := esbtest.NewServer(fixtures)
+	defer srv.Close()
+
+	a, mem := newTestApp(t, srv, map[string]string{"APP_SYNC_MODE": "delta"})
+	watermark := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	mem.states[syncStateName] = model.SyncState{Name: syncStateName, Watermark: watermark, FullSyncAt: time.Now()}
+
+	var modified []map[string]any
+	for _, f := range fixtures {
+		if f["ModifiedDateTime"].(string) >= watermark.Format(time.RFC3339) {
+			modified = append(modified, f)
+		}
+	}
+
+	report, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if report.Full || report.Synced != len(modified) {
+		t.Errorf("report = full %t, %d synced, want delta, %d synced", report.Full, report.Synced, len(modified))
+	}
+	if len(mem.stores) != len(modified) {
+		t.Errorf("stored %d stores, want %d", len(mem.stores), len(modified))
+	}
+	if want := maxModified(t, modified); !mem.states[syncStateName].Watermark.Equal(want) {
+		t.Errorf("watermark = %s, want %s", mem.states[syncStateName].Watermark, want)
+	}
+}
+
+func TestRunRejectsInvalidStores(t *testing.T) {
+	fixtures := esbtest.Stores("RUS", 1, 20)
+	delete(fixtures[4], "NameAlias")
+	fixtures[7]["PrimaryAddress"] = " "
+	srv := esbtest.NewServer(fixtures)
+	defer srv.Close()
+
+	a, mem := newTestApp(t, srv, nil)
+
+	report, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if report.Synced != 18 || len(mem.stores) != 18 {
+		t.Errorf("synced %d, stored %d, want 18", report.Synced, len(mem.stores))
+	}
+	var numbers []string
+	for _, r := range mem.rejections {
+		numbers = append(numbers, r.Number)
+	}
+	slices.Sort(numbers)
+	if !slices.Equal(numbers, []string{"5", "8"}) {
+		t.Errorf("rejected stores = %v, want [5 8]", numbers)
+	}
+}
+
+func TestRunTooManyRejected(t *testing.T) {
+	fixtures := esbtest.Stores("RUS", 1, 20)
+	for _, f := range fixtures[:3] {
+		delete(f, "NameAlias")
+	}
+	srv := esbtest.NewServer(fixtures)
+	defer srv.Close()
+
+	a, mem := newTestApp(t, srv, map[string]string{"APP_MAX_REJECTED": "2", "APP_DELETE_STALE": "true"})
+	mem.stores[storeKey{"RUS", 9999}] = model.Store{Number: 9999, Country: "RUS", SyncedAt: time.Now().Add(-time.Hour)}
+
+	if _, err := a.Run(context.Background()); err == nil {
+		t.Fatal("Run() error = nil, want too many rejected")
+	}
+	if _, ok := mem.stores[storeKey{"RUS", 9999}]; !ok {
+		t.Error("stores were deleted by a failed run")
+	}
+	if _, ok := mem.states[syncStateName]; ok {
+		t.Error("sync state was saved by a failed run")
+	}
+}
+
+func TestRunPartial(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 250))
+	defer srv.Close()
+	srv.Inject(esbtest.Fault{Match: esbtest.OnPage(100), Status: http.StatusBadGateway})
+
+	a, mem := newTestApp(t, srv, map[string]string{"ESB_PARTIAL": "true", "APP_DELETE_STALE": "true"})
+	mem.stores[storeKey{"RUS", 9999}] = model.Store{Number: 9999, Country: "RUS", SyncedAt: time.Now().Add(-time.Hour)}
+
+	report, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if !report.Incomplete() || !slices.Equal(report.FailedPages, []int{1}) {
+		t.Errorf("failed pages = %v, want [1]", report.FailedPages)
+	}
+	if report.Synced != 150 {
+		t.Errorf("synced %d, want 150", report.Synced)
+	}
+	if _, ok := mem.stores[storeKey{"RUS", 9999}]; !ok {
+		t.Error("incomplete run deleted stores")
+	}
+	if _, ok := mem.states[syncStateName]; ok {
+		t.Error("incomplete run saved the sync state")
+	}
+}
+
+func TestRunReplayIsDryRun(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 150))
+	dir := t.TempDir()
+	vars := map[string]string{
+		"APP_SYNC_MODE":     "delta",
+		"ESB_CASSETTE_MODE": "record",
+		"ESB_CASSETTE_DIR":  dir,
+	}
+
+	a, mem := newTestApp(t, srv, vars)
+	mem.states[syncStateName] = model.SyncState{Name: syncStateName, Watermark: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), FullSyncAt: time.Now()}
+	recorded, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("recording Run() error = %v", err)
+	}
+	srv.Close()
+
+	// The replay starts from another watermark, as the next run would.
+	vars["ESB_CASSETTE_MODE"] = "replay"
+	a, mem = newTestApp(t, srv, vars)
+	stale := model.Store{Number: 9999, Country: "RUS", SyncedAt: time.Now().Add(-time.Hour)}
+	mem.stores[keyOf(stale)] = stale
+	state := model.SyncState{Name: syncStateName, Watermark: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), FullSyncAt: time.Now()}
+	mem.states[syncStateName] = state
+
+	replayed, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("replayed Run() error = %v", err)
+	}
+	if replayed.Synced != recorded.Synced {
+		t.Errorf("replayed %d stores, recorded %d", replayed.Synced, recorded.Synced)
+	}
+	if len(mem.stores) != 1 {
+		t.Errorf("replay changed stores: %d stored, want the 1 stale one", len(mem.stores))
+	}
+	if mem.states[syncStateName] != state {
+		t.Errorf("replay changed the sync state to %+v", mem.states[syncStateName])
+	}
+}
+
+func TestNewReplayUsesRecordedState(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 30))
+	dir := t.TempDir()
+	vars := map[string]string{
+		"APP_SYNC_MODE":     "delta",
+		"ESB_CASSETTE_MODE": "record",
+		"ESB_CASSETTE_DIR":  dir,
+	}
+
+	a, mem := newTestApp(t, srv, vars)
+	a.setStorage(newRecordStorage(mem, dir))
+	state := model.SyncState{Name: syncStateName, Watermark: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), FullSyncAt: time.Now().UTC()}
+	mem.states[syncStateName] = state
+	delete(mem.dicts[ydb.Brands], "FIXP")
+	recorded, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("recording Run() error = %v", err)
+	}
+	srv.Close()
+
+	// No YDB is configured, so the replay fails if it connects to one.
+	vars["ESB_CASSETTE_MODE"] = "replay"
+	vars["ESB_BASE_URL"] = srv.URL
+	vars["ESB_API_KEY"] = "key"
+	vars["ESB_COUNTRIES"] = "RUS,KAZ"
+	a, err = New(context.Background(), testConfig(t, vars))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	replayed, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("replayed Run() error = %v", err)
+	}
+
+	if replayed.Synced != recorded.Synced || len(replayed.UnknownCodes) != 1 || replayed.UnknownCodes[0].String() != recorded.UnknownCodes[0].String() {
+		t.Errorf("replayed %d stores, unknown codes %v, recorded %d and %v", replayed.Synced, replayed.UnknownCodes, recorded.Synced, recorded.UnknownCodes)
+	}
+	replayMem := a.ydb.(dryRunStorage).storage.(*memStorage)
+	if got := replayMem.states[syncStateName]; !got.Watermark.Equal(state.Watermark) || !got.FullSyncAt.Equal(state.FullSyncAt) {
+		t.Errorf("replay sync state = %+v, want the recorded %+v", got, state)
+	}
+}
+
+func TestRunKeepsStaleStoresByDefault(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 20))
+	defer srv.Close()
+
+	a, mem := newTestApp(t, srv, nil)
+	stale := model.Store{Number: 9999, Country: "RUS", SyncedAt: time.Now().Add(-time.Hour)}
+	mem.stores[keyOf(stale)] = stale
+
+	if _, err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if _, ok := mem.stores[keyOf(stale)]; !ok {
+		t.Error("stale store deleted without APP_DELETE_STALE")
+	}
+	if mem.states[syncStateName].FullSyncAt.IsZero() {
+		t.Error("full sync time not saved")
+	}
+}
+
+func TestRunKeepsRejectedStores(t *testing.T) {
+	fixtures := esbtest.Stores("RUS", 1, 20)
+	delete(fixtures[4], "NameAlias")
+	srv := esbtest.NewServer(fixtures)
+	defer srv.Close()
+
+	a, mem := newTestApp(t, srv, map[string]string{"APP_DELETE_STALE": "true"})
+	earlier := time.Now().Add(-time.Hour)
+	rejected := model.Store{Number: 5, Country: "RUS", Name: "Магазин 5", SyncedAt: earlier}
+	stale := model.Store{Number: 9999, Country: "RUS", SyncedAt: earlier}
+	mem.stores[keyOf(rejected)] = rejected
+	mem.stores[keyOf(stale)] = stale
+
+	if _, err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got, ok := mem.stores[keyOf(rejected)]; !ok || got.Name != rejected.Name {
+		t.Error("store rejected by the run was deleted or overwritten")
+	}
+	if _, ok := mem.stores[keyOf(stale)]; ok {
+		t.Error("stale store was not deleted")
+	}
+}
+
+func TestRunRejectedStoreHoldsWatermark(t *testing.T) {
+	fixtures := esbtest.Stores("RUS", 1, 20)
+	delete(fixtures[4], "NameAlias")
+	srv := esbtest.NewServer(fixtures)
+	defer srv.Close()
+
+	a, mem := newTestApp(t, srv, nil)
+	if _, err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want, _ := time.Parse(time.RFC3339, fixtures[4]["ModifiedDateTime"].(string))
+	if got := mem.states[syncStateName].Watermark; !got.Equal(want) {
+		t.Errorf("watermark = %s, want %s of the rejected store", got, want)
+	}
+}
+
+func TestNewRefusesDeleteWithFilter(t *testing.T) {
+	_, _, err := newApp(testConfig(t, map[string]string{
+		"ESB_BASE_URL":     "https://esb.example",
+		"ESB_API_KEY":      "key",
+		"ESB_FILTER":       "Status eq 'Open'",
+		"APP_DELETE_STALE": "true",
+	}))
+	if !errors.Is(err, ErrDeleteWithFilter) {
+		t.Errorf("newApp() error = %v, want %v", err, ErrDeleteWithFilter)
+	}
+}
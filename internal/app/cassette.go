@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"go-esb-store/internal/model"
+	"go-esb-store/internal/ydb"
+	"go-esb-store/pkg/logger"
+)
+
+// cassetteStateFile is the file of the cassette directory holding the YDB
+// state of the recorded run. ESB responses are named by a hex hash, so the
+// name does not clash with them.
+const cassetteStateFile = "ydb.json"
+
+// cassetteState is what a recorded run read from YDB.
+type cassetteState struct {
+	SyncStates   map[string]model.SyncState                          `json:"sync_states"`
+	Dictionaries map[ydb.Dictionary]map[string]model.DictionaryEntry `json:"dictionaries"`
+}
+
+// recordStorage passes everything through to the storage it wraps and
+// writes the sync states and dictionaries a run reads to the cassette
+// directory, so that a replay of the run starts from the same state.
+type recordStorage struct {
+	storage
+	path  string
+	state cassetteState
+}
+
+func newRecordStorage(s storage, dir string) *recordStorage {
+	return &recordStorage{
+		storage: s,
+		path:    filepath.Join(dir, cassetteStateFile),
+		state: cassetteState{
+			SyncStates:   make(map[string]model.SyncState),
+			Dictionaries: make(map[ydb.Dictionary]map[string]model.DictionaryEntry),
+		},
+	}
+}
+
+func (s *recordStorage) GetSyncState(ctx context.Context, name string) (*model.SyncState, error) {
+	state, err := s.storage.GetSyncState(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	s.state.SyncStates[name] = *state
+	return state, s.save()
+}
+
+func (s *recordStorage) GetDictionary(ctx context.Context, d ydb.Dictionary) (map[string]model.DictionaryEntry, error) {
+	entries, err := s.storage.GetDictionary(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	s.state.Dictionaries[d] = maps.Clone(entries)
+	return entries, s.save()
+}
+
+func (s *recordStorage) save() error {
+	b, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCassetteState, err)
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("%w: %w", ErrCassetteState, err)
+	}
+	if err = os.WriteFile(s.path, b, 0o644); err != nil {
+		return fmt.Errorf("%w: %w", ErrCassetteState, err)
+	}
+	logger.Debug("app.recordStorage.save: YDB state recorded", "file", s.path)
+	return nil
+}
+
+// loadCassetteStorage returns an in-memory storage holding the YDB state
+// recorded to dir by recordStorage. A cassette without one replays as a
+// first run with empty dictionaries.
+func loadCassetteStorage(dir string) (*memStorage, error) {
+	mem := newMemStorage()
+	path := filepath.Join(dir, cassetteStateFile)
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		logger.Warn("app.loadCassetteStorage: no recorded YDB state, replaying from an empty one", "file", path)
+		return mem, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCassetteState, err)
+	}
+
+	var state cassetteState
+	if err = json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrCassetteState, path, err)
+	}
+	maps.Copy(mem.states, state.SyncStates)
+	maps.Copy(mem.dicts, state.Dictionaries)
+	return mem, nil
+}
@@ -0,0 +1,201 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"go-esb-store/internal/config"
+	"go-esb-store/internal/model"
+	"go-esb-store/internal/ydb"
+	"go-esb-store/pkg/logger"
+)
+
+//go:embed dictionaries.yaml
+var dictionariesSeed []byte
+
+// UnknownCode is a brand or format code of synced stores that is not in
+// its dictionary, or is inactive there.
+type UnknownCode struct {
+	Dictionary ydb.Dictionary
+	Code       string
+	Inactive   bool
+	Stores     []int
+}
+
+func (u UnknownCode) String() string {
+	shown := u.Stores[:min(len(u.Stores), maxRejectedNumbers)]
+	numbers := make([]string, 0, len(shown))
+	for _, n := range shown {
+		numbers = append(numbers, strconv.Itoa(n))
+	}
+	more := ""
+	if len(u.Stores) > len(numbers) {
+		more = ", ..."
+	}
+	inactive := ""
+	if u.Inactive {
+		inactive = " inactive"
+	}
+	return fmt.Sprintf("%s %q%s: %d stores (%s%s)", u.Dictionary, u.Code, inactive, len(u.Stores), strings.Join(numbers, ", "), more)
+}
+
+type dictionaryEntry struct {
+	Code      string `yaml:"code"`
+	Name      string `yaml:"name"`
+	Active    bool   `yaml:"active"`
+	SortOrder int    `yaml:"sort_order"`
+}
+
+// loadDictionaries reads and validates the dictionary seed.
+func loadDictionaries() (map[ydb.Dictionary][]model.DictionaryEntry, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(dictionariesSeed))
+	dec.KnownFields(true)
+
+	var seed struct {
+		Brands  []dictionaryEntry `yaml:"brands"`
+		Formats []dictionaryEntry `yaml:"formats"`
+	}
+	if err := dec.Decode(&seed); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDictionary, err)
+	}
+
+	dicts := make(map[ydb.Dictionary][]model.DictionaryEntry, 2)
+	for d, entries := range map[ydb.Dictionary][]dictionaryEntry{ydb.Brands: seed.Brands, ydb.Formats: seed.Formats} {
+		codes := make(map[string]struct{}, len(entries))
+		for _, e := range entries {
+			if e.Code == "" || e.Name == "" {
+				return nil, fmt.Errorf("%w: %s: entry without code or name", ErrInvalidDictionary, d)
+			}
+			if _, ok := codes[e.Code]; ok {
+				return nil, fmt.Errorf("%w: %s: repeated code %q", ErrInvalidDictionary, d, e.Code)
+			}
+			codes[e.Code] = struct{}{}
+			dicts[d] = append(dicts[d], model.DictionaryEntry(e))
+		}
+	}
+
+	return dicts, nil
+}
+
+// SeedDictionaries adds the codes of the dictionary seed missing from the
+// dictionary tables. It is run by hand, see main.go, never by a sync.
+func SeedDictionaries(ctx context.Context, cfg *config.Config) error {
+	dicts, err := loadDictionaries()
+	if err != nil {
+		return err
+	}
+
+	ydbClient, err := ydb.NewYDBClient(ctx, &cfg.YDB)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = ydbClient.Close(ctx) }()
+
+	return seedDictionaries(ctx, ydbClient, dicts)
+}
+
+// seeder is the part of storage that seeds dictionaries.
+type seeder interface {
+	SeedDictionary(ctx context.Context, d ydb.Dictionary, entries []model.DictionaryEntry) error
+}
+
+func seedDictionaries(ctx context.Context, s seeder, dicts map[ydb.Dictionary][]model.DictionaryEntry) error {
+	for _, d := range []ydb.Dictionary{ydb.Brands, ydb.Formats} {
+		logger.Info("app.seedDictionaries: seeding dictionary", "dictionary", d, "count", len(dicts[d]))
+		if err := s.SeedDictionary(ctx, d, dicts[d]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stores reads the synced stores of the configured countries with the
+// display names of their brand and format.
+func Stores(ctx context.Context, cfg *config.Config) ([]model.StoreView, error) {
+	ydbClient, err := ydb.NewYDBClient(ctx, &cfg.YDB)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = ydbClient.Close(ctx) }()
+
+	return ydbClient.GetStores(ctx, cfg.ESB.Countries...)
+}
+
+// codeCheck checks the brand and format codes of the stores kept by a run
+// against the dictionaries: codes missing from them or inactive there are
+// reported. Empty codes are not checked. It only remembers the stores with
+// such codes.
+type codeCheck struct {
+	dicts   map[ydb.Dictionary]map[string]model.DictionaryEntry
+	unknown map[storeKey]map[ydb.Dictionary]string
+}
+
+// newCodeCheck reads the dictionaries for a run. An empty dictionary is
+// not seeded yet and is skipped rather than flagging every code.
+func (a *App) newCodeCheck(ctx context.Context) (*codeCheck, error) {
+	c := &codeCheck{
+		dicts:   make(map[ydb.Dictionary]map[string]model.DictionaryEntry, 2),
+		unknown: make(map[storeKey]map[ydb.Dictionary]string),
+	}
+	for _, d := range []ydb.Dictionary{ydb.Brands, ydb.Formats} {
+		entries, err := a.ydb.GetDictionary(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			logger.Warn("app.newCodeCheck: dictionary is empty, its codes are not checked", "dictionary", d)
+			continue
+		}
+		c.dicts[d] = entries
+	}
+	return c, nil
+}
+
+// add checks a kept store, replacing the outcome for an earlier store with
+// its key.
+func (c *codeCheck) add(s model.Store) {
+	key := keyOf(s)
+	delete(c.unknown, key)
+	for d, code := range map[ydb.Dictionary]string{ydb.Brands: s.Brand, ydb.Formats: s.Format} {
+		dict, checked := c.dicts[d]
+		if e, ok := dict[code]; checked && code != "" && (!ok || !e.Active) {
+			if c.unknown[key] == nil {
+				c.unknown[key] = make(map[ydb.Dictionary]string, 2)
+			}
+			c.unknown[key][d] = code
+		}
+	}
+}
+
+// codes returns the unknown codes by dictionary and code, with the sorted
+// numbers of their stores.
+func (c *codeCheck) codes() []UnknownCode {
+	var unknown []UnknownCode
+	for _, d := range []ydb.Dictionary{ydb.Brands, ydb.Formats} {
+		byCode := make(map[string][]int)
+		for key, codes := range c.unknown {
+			if code, ok := codes[d]; ok {
+				byCode[code] = append(byCode[code], key.number)
+			}
+		}
+
+		codes := make([]string, 0, len(byCode))
+		for code := range byCode {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+		for _, code := range codes {
+			slices.Sort(byCode[code])
+			_, known := c.dicts[d][code]
+			unknown = append(unknown, UnknownCode{Dictionary: d, Code: code, Inactive: known, Stores: byCode[code]})
+		}
+	}
+	return unknown
+}
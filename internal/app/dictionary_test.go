@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"go-esb-store/internal/esb/esbtest"
+	"go-esb-store/internal/model"
+	"go-esb-store/internal/ydb"
+)
+
+func TestLoadDictionaries(t *testing.T) {
+	if _, err := loadDictionaries(); err != nil {
+		t.Fatalf("loadDictionaries() error = %v", err)
+	}
+}
+
+func TestSeedDictionariesKeepsExistingCodes(t *testing.T) {
+	mem := newMemStorage()
+	mem.dicts[ydb.Brands] = map[string]model.DictionaryEntry{
+		"FIX": {Code: "FIX", Name: "Переименован", Active: false},
+	}
+
+	seed := map[ydb.Dictionary][]model.DictionaryEntry{
+		ydb.Brands: {
+			{Code: "FIX", Name: "Fix Price", Active: true},
+			{Code: "FIXP", Name: "Fix Price Plus", Active: true},
+		},
+	}
+	if err := seedDictionaries(context.Background(), mem, seed); err != nil {
+		t.Fatalf("seedDictionaries() error = %v", err)
+	}
+
+	if e := mem.dicts[ydb.Brands]["FIX"]; e.Name != "Переименован" || e.Active {
+		t.Errorf("FIX = %+v, want the entry maintained in YDB", e)
+	}
+	if e := mem.dicts[ydb.Brands]["FIXP"]; e.Name != "Fix Price Plus" {
+		t.Errorf("FIXP = %+v, want the seeded entry", e)
+	}
+}
+
+func TestRunReportsUnknownAndInactiveCodes(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 12))
+	defer srv.Close()
+
+	a, mem := newTestApp(t, srv, nil)
+	delete(mem.dicts[ydb.Formats], "MALL")
+	fixp := mem.dicts[ydb.Brands]["FIXP"]
+	fixp.Active = false
+	mem.dicts[ydb.Brands]["FIXP"] = fixp
+
+	report, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []UnknownCode{
+		{Dictionary: ydb.Brands, Code: "FIXP", Inactive: true, Stores: []int{2, 5, 8, 11}},
+		{Dictionary: ydb.Formats, Code: "MALL", Stores: []int{3, 7, 11}},
+	}
+	if len(report.UnknownCodes) != len(want) {
+		t.Fatalf("UnknownCodes = %v, want %v", report.UnknownCodes, want)
+	}
+	for i, u := range report.UnknownCodes {
+		if u.String() != want[i].String() {
+			t.Errorf("UnknownCodes[%d] = %v, want %v", i, u, want[i])
+		}
+	}
+	if !report.NeedsAttention() {
+		t.Error("report with unknown codes does not need attention")
+	}
+}
+
+func TestRunSkipsEmptyDictionary(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 12))
+	defer srv.Close()
+
+	a, mem := newTestApp(t, srv, nil)
+	mem.dicts[ydb.Brands] = nil
+	delete(mem.dicts[ydb.Formats], "MALL")
+
+	report, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(report.UnknownCodes) != 1 || report.UnknownCodes[0].Dictionary != ydb.Formats {
+		t.Errorf("UnknownCodes = %v, want only the MALL format", report.UnknownCodes)
+	}
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"go-esb-store/internal/model"
+	"go-esb-store/internal/ydb"
+	"go-esb-store/pkg/logger"
+)
+
+// dryRunStorage reads from the storage it wraps but only logs writes and
+// deletes. A run replayed from a cassette wraps the recorded YDB state
+// with it, so the state stays as recorded.
+type dryRunStorage struct {
+	storage
+}
+
+func (s dryRunStorage) SetSyncState(_ context.Context, state *model.SyncState) error {
+	logger.Info("app.dryRunStorage: skipping sync state update", "name", state.Name, "watermark", state.Watermark, "fullSyncAt", state.FullSyncAt)
+	return nil
+}
+
+func (s dryRunStorage) SetStores(_ context.Context, stores []model.Store) error {
+	logger.Info("app.dryRunStorage: skipping stores upsert", "count", len(stores))
+	return nil
+}
+
+func (s dryRunStorage) DeleteStoresNotSyncedSince(_ context.Context, since time.Time, countries []string, keep []model.StoreKey) error {
+	logger.Info("app.dryRunStorage: skipping stale stores deletion", "since", since, "countries", countries, "kept", len(keep))
+	return nil
+}
+
+func (s dryRunStorage) SetRejections(_ context.Context, _ time.Time, rejections []model.Rejection) error {
+	logger.Info("app.dryRunStorage: skipping rejections insert", "count", len(rejections))
+	return nil
+}
+
+func (s dryRunStorage) UpsertRows(_ context.Context, t *ydb.Table, rows []ydb.Row) error {
+	logger.Info("app.dryRunStorage: skipping rows upsert", "table", t.Name, "count", len(rows))
+	return nil
+}
+
+func (s dryRunStorage) DeleteRowsNotSyncedSince(_ context.Context, t *ydb.Table, since time.Time, keep []ydb.Row) error {
+	logger.Info("app.dryRunStorage: skipping stale rows deletion", "table", t.Name, "since", since, "kept", len(keep))
+	return nil
+}
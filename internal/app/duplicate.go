@@ -0,0 +1,140 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"go-esb-store/internal/model"
+)
+
+// Conflict is a store number ESB returned for more than one record of a
+// country: Store is the record that repeated it, and Kept reports whether
+// the duplicate policy kept it over the earlier one.
+type Conflict struct {
+	Country string
+	Number  int
+	Store   model.Store
+	Kept    bool
+}
+
+func (c Conflict) String() string {
+	if c.Kept {
+		return fmt.Sprintf("%s %d: kept %q (%s) over an earlier record", c.Country, c.Number, c.Store.Name, statusOf(c.Store))
+	}
+	return fmt.Sprintf("%s %d: dropped %q (%s), kept an earlier record", c.Country, c.Number, c.Store.Name, statusOf(c.Store))
+}
+
+// storeKey is the primary key of the stores table. Store numbers are only
+// unique within a country.
+type storeKey struct {
+	country string
+	number  int
+}
+
+func keyOf(s model.Store) storeKey {
+	return storeKey{country: s.Country, number: s.Number}
+}
+
+// dedup keeps one store per country and number over a run, so the stores
+// upserted do not depend on page or batch order. It only remembers how the
+// kept record scored: a later record that beats it is upserted over it.
+type dedup struct {
+	policy model.DuplicatePolicy
+	kept   map[storeKey]ranked
+}
+
+// ranked is how a kept record compares to others with its key.
+type ranked struct {
+	score int
+	hash  uint64
+}
+
+func newDedup(policy model.DuplicatePolicy) *dedup {
+	return &dedup{
+		policy: policy,
+		kept:   make(map[storeKey]ranked),
+	}
+}
+
+// add records s and reports whether it is the store kept for its number,
+// together with the conflict if the number was seen before.
+func (d *dedup) add(s model.Store) (bool, *Conflict) {
+	key, r := keyOf(s), d.rank(s)
+	prev, ok := d.kept[key]
+	if !ok {
+		d.kept[key] = r
+		return true, nil
+	}
+
+	if d.policy != model.FailOnDuplicate && better(r, prev) {
+		d.kept[key] = r
+		return true, &Conflict{Country: s.Country, Number: s.Number, Store: s, Kept: true}
+	}
+	return false, &Conflict{Country: s.Country, Number: s.Number, Store: s}
+}
+
+// count returns how many stores are kept.
+func (d *dedup) count() int {
+	return len(d.kept)
+}
+
+// rank scores s by the policy: open stores first with PreferOpen, then by
+// completeness. The hash of the record breaks ties, so the choice does not
+// depend on the order of the records.
+func (d *dedup) rank(s model.Store) ranked {
+	score := completeness(s)
+	if d.policy == model.PreferOpen && s.Status == model.Open {
+		// Completeness counts a few fields, so open stores always rank
+		// first.
+		score += 1000
+	}
+
+	h := fnv.New64a()
+	b, _ := json.Marshal(s)
+	_, _ = h.Write(b)
+	return ranked{score: score, hash: h.Sum64()}
+}
+
+// better reports whether the record ranked a is to be kept over b.
+func better(a, b ranked) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	return a.hash < b.hash
+}
+
+// putStore adds s to the stores of a page, replacing a store of the page
+// with its key; index holds the positions of the page's keys.
+func putStore(page []model.Store, index map[storeKey]int, s model.Store) []model.Store {
+	key := keyOf(s)
+	if i, ok := index[key]; ok {
+		page[i] = s
+		return page
+	}
+	index[key] = len(page)
+	return append(page, s)
+}
+
+// completeness counts the fields of a store that are filled in.
+func completeness(s model.Store) int {
+	n := 0
+	for _, v := range []string{s.Name, s.Address, s.Country, s.Mall, s.Franchise, s.Brand, s.Format, string(s.Status), s.ClosedReason, s.ESBRegion, s.ESBCity, s.Phone} {
+		if v != "" {
+			n++
+		}
+	}
+	for _, t := range []bool{s.OpeningDate != nil, s.ClosingDate != nil, s.Latitude != nil, s.Area != nil} {
+		if t {
+			n++
+		}
+	}
+	return n
+}
+
+func statusOf(s model.Store) model.Status {
+	if s.Status == "" {
+		return model.Undefined
+	}
+	return s.Status
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"go-esb-store/internal/esb/esbtest"
+	"go-esb-store/internal/model"
+	"go-esb-store/internal/ydb"
+)
+
+func TestDedupDoesNotDependOnOrder(t *testing.T) {
+	open := model.Store{Country: "RUS", Number: 1, Name: "Открыт", Status: model.Open}
+	closed := model.Store{Country: "RUS", Number: 1, Name: "Закрыт", Status: model.Closed, Phone: "+7 495 000-00-00"}
+
+	tests := []struct {
+		policy model.DuplicatePolicy
+		want   string
+	}{
+		{model.PreferOpen, "Открыт"},
+		{model.PreferComplete, "Закрыт"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			for _, order := range [][]model.Store{{open, closed}, {closed, open}} {
+				d := newDedup(tt.policy)
+				var kept model.Store
+				for _, s := range order {
+					if ok, _ := d.add(s); ok {
+						kept = s
+					}
+				}
+				if kept.Name != tt.want || d.count() != 1 {
+					t.Errorf("kept %q of %d stores after %q, want %q of 1", kept.Name, d.count(), order[0].Name, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupFailKeepsFirst(t *testing.T) {
+	d := newDedup(model.FailOnDuplicate)
+	d.add(model.Store{Country: "RUS", Number: 1, Status: model.Closed})
+
+	keep, conflict := d.add(model.Store{Country: "RUS", Number: 1, Status: model.Open})
+	if keep || conflict == nil || conflict.Kept {
+		t.Errorf("add() = %t, %+v, want a conflict dropping the duplicate", keep, conflict)
+	}
+}
+
+// duplicateFixtures returns stores with a second, closed record of RUS 3,
+// numbered with leading zeros so that ESB paging does not drop it.
+func duplicateFixtures() []map[string]any {
+	fixtures := esbtest.Stores("RUS", 1, 5)
+	dup := maps.Clone(fixtures[2])
+	dup["StoreFactsNumber"] = "003"
+	dup["NameAlias"] = "Дубль"
+	dup["Status"] = "Closed"
+	return append(fixtures, dup)
+}
+
+func TestRunDuplicateKeepsOpen(t *testing.T) {
+	srv := esbtest.NewServer(duplicateFixtures())
+	defer srv.Close()
+
+	a, mem := newTestApp(t, srv, map[string]string{"ESB_LIMIT_PAGE_SIZE": "2"})
+	report, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if report.Synced != 5 || len(report.Conflicts) != 1 {
+		t.Errorf("report = %d synced, %d conflicts, want 5 and 1", report.Synced, len(report.Conflicts))
+	}
+	if s := mem.stores[storeKey{"RUS", 3}]; s.Status != model.Open {
+		t.Errorf("RUS 3 status = %q, want the open record", s.Status)
+	}
+}
+
+func TestRunFailOnDuplicateKeepsState(t *testing.T) {
+	srv := esbtest.NewServer(duplicateFixtures())
+	defer srv.Close()
+
+	a, mem := newTestApp(t, srv, map[string]string{"ESB_LIMIT_PAGE_SIZE": "2", "APP_DUPLICATE_POLICY": "fail", "APP_DELETE_STALE": "true"})
+	stale := model.Store{Country: "RUS", Number: 9999, SyncedAt: time.Now().Add(-time.Hour)}
+	mem.stores[keyOf(stale)] = stale
+
+	if _, err := a.Run(context.Background()); !errors.Is(err, ErrDuplicateStores) {
+		t.Fatalf("Run() error = %v, want %v", err, ErrDuplicateStores)
+	}
+	if len(mem.stores) != 6 {
+		t.Errorf("failed run left %d stores, want the 5 fetched and the stale one", len(mem.stores))
+	}
+	if _, ok := mem.states[syncStateName]; ok {
+		t.Error("failed run saved the sync state")
+	}
+}
+
+func TestConflictsSummaryIsTruncated(t *testing.T) {
+	r := &Report{}
+	for i := range maxConflicts + 5 {
+		r.Conflicts = append(r.Conflicts, Conflict{Country: "RUS", Number: i, Store: model.Store{Name: strings.Repeat("Магазин", 20)}})
+	}
+
+	summary := r.conflictsSummary()
+	if lines := strings.Count(summary, "\n"); lines != maxConflicts+1 {
+		t.Errorf("summary has %d lines, want %d", lines+1, maxConflicts+2)
+	}
+	if !strings.HasSuffix(summary, "and 5 more") {
+		t.Errorf("summary does not end with the count of the others:\n%s", summary)
+	}
+}
+
+func TestCodeCheckKeepsLastRecord(t *testing.T) {
+	c := &codeCheck{
+		dicts: map[ydb.Dictionary]map[string]model.DictionaryEntry{
+			ydb.Brands:  {"FIX": {Code: "FIX", Active: true}},
+			ydb.Formats: {"STD": {Code: "STD", Active: true}},
+		},
+		unknown: make(map[storeKey]map[ydb.Dictionary]string),
+	}
+	c.add(model.Store{Country: "RUS", Number: 1, Brand: "NOPE", Format: "STD"})
+	c.add(model.Store{Country: "RUS", Number: 2, Brand: "FIX", Format: "BIG"})
+	c.add(model.Store{Country: "RUS", Number: 1, Brand: "FIX", Format: "STD"})
+
+	got := c.codes()
+	if len(got) != 1 || got[0].Dictionary != ydb.Formats || got[0].Code != "BIG" || len(got[0].Stores) != 1 || got[0].Stores[0] != 2 {
+		t.Errorf("codes() = %+v, want format BIG of store 2", got)
+	}
+}
@@ -0,0 +1,333 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"go-esb-store/internal/esb"
+	"go-esb-store/internal/utils"
+	"go-esb-store/internal/ydb"
+	"go-esb-store/pkg/logger"
+)
+
+//go:embed entities.yaml
+var defaultEntities []byte
+
+// Entity describes an ESB entity set synced into its own YDB table. Every
+// run fetches the whole entity set, upserts it and, with APP_DELETE_STALE
+// and if no page failed, deletes the rows it did not see. Entities are
+// defined in YAML, see entities.yaml, which holds the default ones; to add
+// one, describe it there or in APP_ENTITIES_FILE and list its name in
+// APP_ENTITIES.
+type Entity struct {
+	// Name identifies the entity in APP_ENTITIES and in the report.
+	Name string `yaml:"name"`
+	// Set is the OData entity set, e.g. "LegalEntitiesESB".
+	Set string `yaml:"set"`
+	// Filter is a static $filter of the entity set, if any.
+	Filter string `yaml:"filter"`
+	// Table is the target table, resolved through YDB_TABLES_MAP.
+	Table string `yaml:"table"`
+	// Fields maps ESB fields to table columns. The Key fields make the
+	// primary key and order the ESB pages.
+	Fields []Field `yaml:"fields"`
+	// AllowEmpty accepts an empty entity set, which otherwise fails the
+	// run as ESB returning no data.
+	AllowEmpty bool `yaml:"allow_empty"`
+}
+
+// Field maps an ESB field to a table column. Strings are cleaned with
+// utils.CleanString, and blank strings are stored as NULL unless Fallback
+// names a column whose value fills them.
+type Field struct {
+	Source   string         `yaml:"source"`
+	Column   string         `yaml:"column"`
+	Type     ydb.ColumnType `yaml:"type"`
+	Key      bool           `yaml:"key"`
+	Required bool           `yaml:"required"`
+	Fallback string         `yaml:"fallback"`
+}
+
+// LoadEntities reads entity definitions from path, or the default ones if
+// path is empty, and validates them. They are returned by name.
+func LoadEntities(path string) (map[string]*Entity, error) {
+	b := defaultEntities
+	if path != "" {
+		var err error
+		if b, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidEntity, err)
+		}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+
+	var defs struct {
+		Entities []*Entity `yaml:"entities"`
+	}
+	if err := dec.Decode(&defs); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidEntity, err)
+	}
+
+	entities := make(map[string]*Entity, len(defs.Entities))
+	for _, e := range defs.Entities {
+		if _, ok := entities[e.Name]; ok || e.Name == "" {
+			return nil, fmt.Errorf("%w: invalid or repeated name %q", ErrInvalidEntity, e.Name)
+		}
+		if err := e.validate(); err != nil {
+			return nil, err
+		}
+		entities[e.Name] = e
+	}
+
+	return entities, nil
+}
+
+// validate checks the descriptor before any request is made.
+func (e *Entity) validate() error {
+	if e.Set == "" {
+		return fmt.Errorf("%w: %s: no entity set", ErrInvalidEntity, e.Name)
+	}
+	for _, f := range e.Fields {
+		if f.Source == "" {
+			return fmt.Errorf("%w: %s: field of column %q has no source", ErrInvalidEntity, e.Name, f.Column)
+		}
+		if f.Column == ydb.SyncedAtColumn {
+			return fmt.Errorf("%w: %s: column %q is reserved", ErrInvalidEntity, e.Name, f.Column)
+		}
+		if f.Fallback == "" {
+			continue
+		}
+		i := slices.IndexFunc(e.Fields, func(o Field) bool { return o.Column == f.Fallback })
+		if i < 0 || f.Fallback == f.Column || e.Fields[i].Type != f.Type || e.Fields[i].Fallback != "" {
+			return fmt.Errorf("%w: %s: fallback of column %q must be another column of type %s without a fallback", ErrInvalidEntity, e.Name, f.Column, f.Type)
+		}
+	}
+	if err := e.table().Validate(); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidEntity, e.Name, err)
+	}
+	return nil
+}
+
+// esbEntity returns the ESB side of the descriptor: the mapped fields are
+// selected and the key fields order the pages.
+func (e *Entity) esbEntity() esb.Entity {
+	var orderBy, fields []string
+	for _, f := range e.Fields {
+		fields = append(fields, f.Source)
+		if f.Key {
+			orderBy = append(orderBy, f.Source)
+		}
+	}
+
+	return esb.Entity{
+		Set:        e.Set,
+		Filter:     e.Filter,
+		OrderBy:    strings.Join(orderBy, ","),
+		Select:     fields,
+		Key:        orderBy,
+		AllowEmpty: e.AllowEmpty,
+	}
+}
+
+// table returns the YDB side of the descriptor, with a synced_at column
+// for deleting stale rows.
+func (e *Entity) table() *ydb.Table {
+	t := &ydb.Table{Name: e.Table}
+	for _, f := range e.Fields {
+		t.Columns = append(t.Columns, ydb.Column{Name: f.Column, Type: f.Type})
+		if f.Key {
+			t.Key = append(t.Key, f.Column)
+		}
+	}
+	t.Columns = append(t.Columns, ydb.Column{Name: ydb.SyncedAtColumn, Type: ydb.Timestamp})
+
+	return t
+}
+
+// toRow converts an ESB record with Fields. A record whose key or
+// required fields are missing, or with a value of the wrong type, is
+// rejected with a *RejectError.
+func (e *Entity) toRow(rec esb.Record) (ydb.Row, error) {
+	row := make(ydb.Row, len(e.Fields)+1)
+	for _, f := range e.Fields {
+		v, err := fieldValue(f.Type, rec[f.Source])
+		if err != nil {
+			logger.Debug("app.Entity.toRow: invalid field value", "error", err, "entity", e.Name, "field", f.Source)
+			value := fmt.Sprint(rec[f.Source])
+			return nil, reject(ErrInvalidField, f.Source, &value)
+		}
+		row[f.Column] = v
+	}
+
+	for _, f := range e.Fields {
+		if row[f.Column] == nil && f.Fallback != "" {
+			row[f.Column] = row[f.Fallback]
+		}
+		if row[f.Column] == nil && (f.Key || f.Required) {
+			return nil, reject(ErrMissingField, f.Source, nil)
+		}
+	}
+
+	return row, nil
+}
+
+// keyRow returns the key columns of a record, or false if one of them is
+// missing or invalid.
+func (e *Entity) keyRow(rec esb.Record) (ydb.Row, bool) {
+	row := make(ydb.Row)
+	for _, f := range e.Fields {
+		if !f.Key {
+			continue
+		}
+		v, err := fieldValue(f.Type, rec[f.Source])
+		if err != nil || v == nil {
+			return nil, false
+		}
+		row[f.Column] = v
+	}
+	return row, true
+}
+
+// fieldValue converts a value decoded with UseNumber to the Go type of a
+// column. ESB sends some numbers and flags as strings, so those are parsed.
+func fieldValue(t ydb.ColumnType, v any) (any, error) {
+	if s, ok := v.(string); ok {
+		if s = utils.CleanString(s); s == "" {
+			return nil, nil
+		}
+		v = s
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	switch t {
+	case ydb.Utf8:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case json.Number:
+			return v.String(), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+	case ydb.Int64:
+		switch v := v.(type) {
+		case string:
+			return strconv.ParseInt(v, 10, 64)
+		case json.Number:
+			return v.Int64()
+		}
+	case ydb.Double:
+		switch v := v.(type) {
+		case string:
+			return strconv.ParseFloat(v, 64)
+		case json.Number:
+			return v.Float64()
+		}
+	case ydb.Bool:
+		switch v := v.(type) {
+		case string:
+			return strconv.ParseBool(v)
+		case bool:
+			return v, nil
+		}
+	case ydb.Date, ydb.Timestamp:
+		if s, ok := v.(string); ok {
+			return utils.ParseTimeString(s)
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected %T for %s", v, t)
+}
+
+// syncEntity fetches an entity set into its table and adds the outcome to
+// report. Records that fail conversion are handled like rejected stores:
+// they are saved to the rejected stores table, more than APP_MAX_REJECTED
+// of them fail the run, and their rows are not deleted.
+func (a *App) syncEntity(ctx context.Context, e *Entity, runStart time.Time, report *Report) error {
+	table := e.table()
+	er := &EntityReport{Name: e.Name}
+	report.Entities = append(report.Entities, er)
+
+	var (
+		// keep holds the keys of the rejected records, which are not gone
+		// from ESB.
+		keep    []ydb.Row
+		unkeyed int
+	)
+	logger.Info("app.syncEntity: sync started", "entity", e.Name, "set", e.Set)
+	for records, err := range a.esb.EntityPages(ctx, e.esbEntity()) {
+		var pageErr *esb.PageError
+		if errors.As(err, &pageErr) {
+			logger.Warn("app.syncEntity: skipping failed page", "error", pageErr, "entity", e.Name, "page", pageErr.Page)
+			er.FailedPages = append(er.FailedPages, pageErr.Page)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+
+		rows := make([]ydb.Row, 0, len(records))
+		for i, rec := range records {
+			row, err := e.toRow(rec)
+			if err != nil {
+				logger.Error("app.syncEntity: failed to convert record", "error", err, "entity", e.Name, "record", rec, "index", i)
+				er.Rejected = append(er.Rejected, e.newRejection(rec, err))
+				if key, ok := e.keyRow(rec); ok {
+					keep = append(keep, key)
+				} else {
+					unkeyed++
+				}
+				continue
+			}
+			row[ydb.SyncedAtColumn] = runStart
+			rows = append(rows, row)
+		}
+
+		if err = a.ydb.UpsertRows(ctx, table, rows); err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+		er.Synced += len(rows)
+	}
+
+	if len(er.Rejected) > 0 {
+		logger.Warn("app.syncEntity: records rejected", "entity", e.Name, "count", len(er.Rejected), "max", a.maxRejected)
+		if err := a.ydb.SetRejections(ctx, runStart, er.Rejected); err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+	if a.maxRejected > 0 && len(er.Rejected) > a.maxRejected {
+		return fmt.Errorf("%s: %w: %d, max %d\n\n%s", e.Name, ErrTooManyRejected, len(er.Rejected), a.maxRejected, rejectedSummary(e.Name, er.Rejected))
+	}
+
+	if len(er.FailedPages) > 0 {
+		logger.Warn("app.syncEntity: incomplete sync, skipping deletions", "entity", e.Name, "count", er.Synced, "failedPages", er.FailedPages)
+		return nil
+	}
+
+	if a.deleteStale {
+		// The row of a rejected record without a key cannot be told apart,
+		// so nothing is deleted.
+		if unkeyed > 0 {
+			logger.Warn("app.syncEntity: rejected records without a key, skipping deletions", "entity", e.Name, "count", unkeyed)
+		} else if err := a.ydb.DeleteRowsNotSyncedSince(ctx, table, runStart, keep); err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+
+	logger.Info("app.syncEntity: entity synced", "entity", e.Name, "count", er.Synced, "rejected", len(er.Rejected))
+	return nil
+}
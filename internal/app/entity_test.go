@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-esb-store/internal/esb"
+	"go-esb-store/internal/esb/esbtest"
+	"go-esb-store/internal/ydb"
+)
+
+func TestLoadEntities(t *testing.T) {
+	entities, err := LoadEntities("")
+	if err != nil {
+		t.Fatalf("LoadEntities() error = %v", err)
+	}
+	for _, name := range []string{"legal_entities", "franchise_partners", "store_formats"} {
+		if entities[name] == nil {
+			t.Errorf("default entities have no %q", name)
+		}
+	}
+
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{"unknown key", "entities:\n  - name: x\n    set: X\n    table: x\n    fields:\n      - {source: Id, column: id, type: Utf8, key: true, primary: true}\n"},
+		{"no key", "entities:\n  - name: x\n    set: X\n    table: x\n    fields:\n      - {source: Id, column: id, type: Utf8}\n"},
+		{"unknown type", "entities:\n  - name: x\n    set: X\n    table: x\n    fields:\n      - {source: Id, column: id, type: String, key: true}\n"},
+		{"missing fallback", "entities:\n  - name: x\n    set: X\n    table: x\n    fields:\n      - {source: Id, column: id, type: Utf8, key: true}\n      - {source: Name, column: name, type: Utf8, fallback: code}\n"},
+		{"fallback of another type", "entities:\n  - name: x\n    set: X\n    table: x\n    fields:\n      - {source: Id, column: id, type: Int64, key: true}\n      - {source: Name, column: name, type: Utf8, fallback: id}\n"},
+		{"repeated name", "entities:\n  - name: x\n    set: X\n    table: x\n    fields:\n      - {source: Id, column: id, type: Utf8, key: true}\n  - name: x\n    set: Y\n    table: y\n    fields:\n      - {source: Id, column: id, type: Utf8, key: true}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "entities.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadEntities(path); !errors.Is(err, ErrInvalidEntity) {
+				t.Errorf("LoadEntities() error = %v, want %v", err, ErrInvalidEntity)
+			}
+		})
+	}
+}
+
+func TestRunEntityFromFile(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 5))
+	defer srv.Close()
+	srv.SetEntitySet("StoreFormatsESB", []map[string]any{
+		{"StoreFormatId": "STD", "Description": "Стандарт"},
+		{"StoreFormatId": "MINI"},
+	})
+
+	path := filepath.Join(t.TempDir(), "entities.yaml")
+	def := "entities:\n  - name: store_formats\n    set: StoreFormatsESB\n    table: store_formats\n    fields:\n" +
+		"      - {source: StoreFormatId, column: id, type: Utf8, key: true}\n" +
+		"      - {source: Description, column: name, type: Utf8, fallback: id}\n"
+	if err := os.WriteFile(path, []byte(def), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, mem := newTestApp(t, srv, map[string]string{"APP_ENTITIES": "store_formats", "APP_ENTITIES_FILE": path})
+	if _, err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	rows := mem.rows["store_formats"]
+	if got := rows["STD"]["name"]; got != "Стандарт" {
+		t.Errorf("STD name = %v, want Стандарт", got)
+	}
+	if got := rows["MINI"]["name"]; got != "MINI" {
+		t.Errorf("MINI name = %v, want the code", got)
+	}
+}
+
+func TestRunEntityKeepsRejectedRows(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 5))
+	defer srv.Close()
+	srv.SetEntitySet("LegalEntitiesESB", []map[string]any{
+		{"LegalEntityId": "LE1", "Name": "ООО «Один»"},
+		{"LegalEntityId": "LE2", "Name": " "},
+	})
+
+	a, mem := newTestApp(t, srv, map[string]string{"APP_ENTITIES": "legal_entities", "APP_DELETE_STALE": "true"})
+	earlier := time.Now().Add(-24 * time.Hour)
+	mem.rows["legal_entities"] = map[string]ydb.Row{
+		"LE2": {"id": "LE2", "name": "ООО «Два»", ydb.SyncedAtColumn: earlier},
+		"LE3": {"id": "LE3", "name": "ООО «Три»", ydb.SyncedAtColumn: earlier},
+	}
+
+	report, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	er := report.Entities[0]
+	if er.Synced != 1 || len(er.Rejected) != 1 {
+		t.Fatalf("entity report = %d synced, %d rejected, want 1 and 1", er.Synced, len(er.Rejected))
+	}
+	if rej := er.Rejected[0]; rej.Entity != "legal_entities" || rej.Number != "LE2" || rej.Rule != ErrMissingField.Error() || rej.Field != "Name" {
+		t.Errorf("rejection = %+v, want LE2 missing Name", rej)
+	}
+	if len(mem.rejections) != 1 || mem.rejections[0].Entity != "legal_entities" {
+		t.Errorf("saved rejections = %+v, want the LE2 one", mem.rejections)
+	}
+	if !report.NeedsAttention() {
+		t.Error("report with rejected records does not need attention")
+	}
+
+	rows := mem.rows["legal_entities"]
+	if _, ok := rows["LE2"]; !ok {
+		t.Error("row of a rejected record was deleted")
+	}
+	if _, ok := rows["LE3"]; ok {
+		t.Error("row gone from ESB was not deleted")
+	}
+}
+
+func TestRunEntityRejectedWithoutKey(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 5))
+	defer srv.Close()
+	srv.SetEntitySet("LegalEntitiesESB", []map[string]any{
+		{"LegalEntityId": "LE1", "Name": "ООО «Один»"},
+		{"Name": "ООО «Без кода»"},
+	})
+
+	a, mem := newTestApp(t, srv, map[string]string{"APP_ENTITIES": "legal_entities", "APP_DELETE_STALE": "true"})
+	mem.rows["legal_entities"] = map[string]ydb.Row{
+		"LE3": {"id": "LE3", "name": "ООО «Три»", ydb.SyncedAtColumn: time.Now().Add(-24 * time.Hour)},
+	}
+
+	if _, err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if _, ok := mem.rows["legal_entities"]["LE3"]; !ok {
+		t.Error("rows were deleted although a rejected record had no key")
+	}
+}
+
+func TestRunEntityTooManyRejected(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 5))
+	defer srv.Close()
+	srv.SetEntitySet("LegalEntitiesESB", []map[string]any{
+		{"LegalEntityId": "LE1"},
+		{"LegalEntityId": "LE2"},
+		{"LegalEntityId": "LE3", "Name": "ООО «Три»"},
+	})
+
+	a, mem := newTestApp(t, srv, map[string]string{"APP_ENTITIES": "legal_entities", "APP_MAX_REJECTED": "1"})
+
+	_, err := a.Run(context.Background())
+	if !errors.Is(err, ErrTooManyRejected) {
+		t.Fatalf("Run() error = %v, want %v", err, ErrTooManyRejected)
+	}
+	if len(mem.rejections) != 2 {
+		t.Errorf("saved %d rejections, want 2", len(mem.rejections))
+	}
+}
+
+func TestRunEntityEmpty(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 5))
+	defer srv.Close()
+	srv.SetEntitySet("FranchisePartnersESB", nil)
+	srv.SetEntitySet("LegalEntitiesESB", nil)
+
+	a, _ := newTestApp(t, srv, map[string]string{"APP_ENTITIES": "franchise_partners"})
+	report, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v, want an allowed empty entity set", err)
+	}
+	if er := report.Entities[0]; er.Synced != 0 || len(er.FailedPages) > 0 {
+		t.Errorf("entity report = %+v, want nothing synced", er)
+	}
+
+	a, _ = newTestApp(t, srv, map[string]string{"APP_ENTITIES": "legal_entities"})
+	if _, err = a.Run(context.Background()); !errors.Is(err, esb.ErrNoPageToFetch) {
+		t.Errorf("Run() error = %v, want %v", err, esb.ErrNoPageToFetch)
+	}
+}
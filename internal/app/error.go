@@ -7,3 +7,15 @@ var ErrEmptyStoreFactsNumber = errors.New("empty store facts number")
 var ErrParseStoreFactsNumber = errors.New("unable to parse store facts number")
 var ErrInvalidStoreName = errors.New("invalid store name alias")
 var ErrInvalidStoreAddress = errors.New("invalid primary address")
+var ErrUnsupportedSyncMode = errors.New("unsupported sync mode")
+var ErrUnsupportedEntity = errors.New("unsupported entity")
+var ErrInvalidEntity = errors.New("invalid entity definition")
+var ErrMissingField = errors.New("missing required field")
+var ErrInvalidField = errors.New("invalid field value")
+var ErrTooManyRejected = errors.New("too many records rejected")
+var ErrUnsupportedDuplicatePolicy = errors.New("unsupported duplicate policy")
+var ErrDuplicateStores = errors.New("duplicate store numbers")
+var ErrInvalidMapping = errors.New("invalid store mapping")
+var ErrInvalidDictionary = errors.New("invalid dictionary")
+var ErrDeleteWithFilter = errors.New("stale deletion with an ESB filter")
+var ErrCassetteState = errors.New("cassette YDB state")
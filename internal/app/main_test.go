@@ -0,0 +1,29 @@
+package app
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/caarlos0/env/v11"
+
+	"go-esb-store/internal/config"
+	"go-esb-store/pkg/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init(slog.LevelError + 1)
+	os.Exit(m.Run())
+}
+
+// testConfig returns the config with the defaults of its env tags and the
+// variables in environment set, ignoring the process environment.
+func testConfig(t *testing.T, environment map[string]string) *config.Config {
+	t.Helper()
+
+	var cfg config.Config
+	if err := env.ParseWithOptions(&cfg, env.Options{Environment: environment}); err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	return &cfg
+}
@@ -0,0 +1,444 @@
+package app
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"go-esb-store/internal/esb"
+	"go-esb-store/internal/model"
+	"go-esb-store/internal/utils"
+	"go-esb-store/pkg/logger"
+)
+
+//go:embed mapping.yaml
+var defaultMapping []byte
+
+// Mapping converts ESB stores to model stores field by field, as described
+// by a YAML definition; see mapping.yaml, which is the default one.
+type Mapping struct {
+	Fields []FieldMapping `yaml:"fields"`
+
+	fields []*fieldMapper
+}
+
+// FieldMapping maps an ESB field to a model.Store field.
+type FieldMapping struct {
+	Source   string            `yaml:"source"`
+	Target   string            `yaml:"target"`
+	Required bool              `yaml:"required"`
+	Cleaners []string          `yaml:"cleaners"`
+	Default  *string           `yaml:"default"`
+	Values   map[string]string `yaml:"values"`
+	Unmapped string            `yaml:"unmapped"`
+	Checks   []string          `yaml:"checks"`
+	Errors   struct {
+		Missing string `yaml:"missing"`
+		Empty   string `yaml:"empty"`
+		Invalid string `yaml:"invalid"`
+	} `yaml:"errors"`
+}
+
+// fieldMapper is a validated FieldMapping.
+type fieldMapper struct {
+	*FieldMapping
+	source   int
+	target   int
+	kind     targetKind
+	cleaners []func(string) string
+	checks   []func(float64) bool
+	missing  error
+	empty    error
+	invalid  error
+	fallback reflect.Value
+}
+
+type targetKind int
+
+const (
+	stringTarget targetKind = iota
+	intTarget
+	boolTarget
+	floatTarget
+	timeTarget
+)
+
+var cleaners = map[string]func(string) string{
+	"clean":           utils.CleanString,
+	"upper":           strings.ToUpper,
+	"lower":           strings.ToLower,
+	"collapse_spaces": func(s string) string { return strings.Join(strings.Fields(s), " ") },
+}
+
+var checks = map[string]func(float64) bool{
+	"positive":  func(f float64) bool { return f > 0 },
+	"latitude":  func(f float64) bool { return f >= -90 && f <= 90 },
+	"longitude": func(f float64) bool { return f >= -180 && f <= 180 },
+}
+
+// rules name the Err* sentinels a mapping can reject a store with.
+var rules = map[string]error{
+	"invalid_store_facts_number": ErrInvalidStoreFactsNumber,
+	"empty_store_facts_number":   ErrEmptyStoreFactsNumber,
+	"parse_store_facts_number":   ErrParseStoreFactsNumber,
+	"invalid_store_name":         ErrInvalidStoreName,
+	"invalid_store_address":      ErrInvalidStoreAddress,
+	"missing_field":              ErrMissingField,
+	"invalid_field":              ErrInvalidField,
+}
+
+// derivedStoreFields are model.Store fields set after the mapping.
+var derivedStoreFields = map[string]struct{}{
+	"NormalizedAddress": {},
+	"PostalCode":        {},
+	"AddressRegion":     {},
+	"AddressCity":       {},
+	"Street":            {},
+	"House":             {},
+	"SyncedAt":          {},
+}
+
+var (
+	esbStoreType   = reflect.TypeOf(esb.Store{})
+	modelStoreType = reflect.TypeOf(model.Store{})
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// LoadMapping reads a mapping from path, or the default one if path is
+// empty, and validates it.
+func LoadMapping(path string) (*Mapping, error) {
+	b := defaultMapping
+	if path != "" {
+		var err error
+		if b, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidMapping, err)
+		}
+	}
+
+	// Unknown keys are rejected, so a typo does not silently drop a rule.
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+
+	var m Mapping
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMapping, err)
+	}
+	if err := m.compile(); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Sources returns the ESB fields the mapping reads, which are all the
+// store fields the app needs to $select.
+func (m *Mapping) Sources() []string {
+	sources := make([]string, 0, len(m.Fields))
+	for _, f := range m.Fields {
+		sources = append(sources, f.Source)
+	}
+	return sources
+}
+
+// compile validates the field mappings against esb.Store and model.Store.
+func (m *Mapping) compile() error {
+	sources := make(map[string]int, esbStoreType.NumField())
+	for i := 0; i < esbStoreType.NumField(); i++ {
+		name, _, _ := strings.Cut(esbStoreType.Field(i).Tag.Get("json"), ",")
+		sources[name] = i
+	}
+
+	targets := make(map[string]struct{}, len(m.Fields))
+	for i := range m.Fields {
+		f := &m.Fields[i]
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("%w: %s -> %s: %s", ErrInvalidMapping, f.Source, f.Target, fmt.Sprintf(format, args...))
+		}
+
+		source, ok := sources[f.Source]
+		if !ok {
+			return fail("unknown ESB field")
+		}
+		target, ok := modelStoreType.FieldByName(f.Target)
+		if _, derived := derivedStoreFields[f.Target]; !ok || derived {
+			return fail("unknown store field")
+		}
+		if _, ok := targets[f.Target]; ok {
+			return fail("store field mapped twice")
+		}
+		targets[f.Target] = struct{}{}
+
+		fm := &fieldMapper{FieldMapping: f, source: source, target: target.Index[0]}
+
+		kind, ok := kindOf(target.Type)
+		if !ok {
+			return fail("unsupported store field type %s", target.Type)
+		}
+		fm.kind = kind
+
+		sourceKind := esbStoreType.Field(source).Type.Elem().Kind()
+		if sourceKind != reflect.String && (len(f.Cleaners) > 0 || len(f.Values) > 0 || f.Unmapped != "" || kind == timeTarget) {
+			return fail("cleaners, values and dates need a string ESB field")
+		}
+		for _, name := range f.Cleaners {
+			clean, ok := cleaners[name]
+			if !ok {
+				return fail("unknown cleaner %q", name)
+			}
+			fm.cleaners = append(fm.cleaners, clean)
+		}
+		for _, name := range f.Checks {
+			check, ok := checks[name]
+			if !ok {
+				return fail("unknown check %q", name)
+			}
+			if kind != intTarget && kind != floatTarget {
+				return fail("check %q needs a numeric store field", name)
+			}
+			fm.checks = append(fm.checks, check)
+		}
+
+		var err error
+		if fm.missing, err = rule(f.Errors.Missing, ErrMissingField); err != nil {
+			return fail("%s", err)
+		}
+		if fm.empty, err = rule(f.Errors.Empty, fm.missing); err != nil {
+			return fail("%s", err)
+		}
+		if fm.invalid, err = rule(f.Errors.Invalid, ErrInvalidField); err != nil {
+			return fail("%s", err)
+		}
+
+		if f.Default != nil {
+			if f.Required {
+				return fail("a required field has no default")
+			}
+			if fm.fallback, err = fm.convert(*f.Default); err != nil {
+				return fail("invalid default: %s", err)
+			}
+		}
+
+		m.fields = append(m.fields, fm)
+	}
+
+	if _, ok := targets["Number"]; !ok {
+		return fmt.Errorf("%w: Number is not mapped", ErrInvalidMapping)
+	}
+	for _, fm := range m.fields {
+		if fm.Target == "Number" && !fm.Required {
+			return fmt.Errorf("%w: Number must be required", ErrInvalidMapping)
+		}
+	}
+
+	return nil
+}
+
+func kindOf(t reflect.Type) (targetKind, bool) {
+	switch {
+	case t.Kind() == reflect.String:
+		return stringTarget, true
+	case t.Kind() == reflect.Int:
+		return intTarget, true
+	case t.Kind() == reflect.Bool:
+		return boolTarget, true
+	case t == reflect.PointerTo(reflect.TypeOf(float64(0))):
+		return floatTarget, true
+	case t == reflect.PointerTo(timeType):
+		return timeTarget, true
+	default:
+		return 0, false
+	}
+}
+
+func rule(name string, fallback error) (error, error) {
+	if name == "" {
+		return fallback, nil
+	}
+	err, ok := rules[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown rule %q", name)
+	}
+	return err, nil
+}
+
+// Apply converts an ESB store. It fails with a *RejectError if a required
+// field is missing or invalid; an invalid optional field is left empty.
+func (m *Mapping) Apply(rawStore esb.Store) (*model.Store, error) {
+	store := &model.Store{}
+	raw := reflect.ValueOf(rawStore)
+	out := reflect.ValueOf(store).Elem()
+
+	for _, fm := range m.fields {
+		src := raw.Field(fm.source)
+		if src.IsNil() {
+			if fm.Required {
+				return nil, reject(fm.missing, fm.Source, nil)
+			}
+			if fm.fallback.IsValid() {
+				out.Field(fm.target).Set(fm.fallback)
+			}
+			continue
+		}
+
+		value, text := src.Elem().Interface(), rawText(src.Elem())
+		if src.Elem().Kind() == reflect.String {
+			s := src.Elem().String()
+			for _, clean := range fm.cleaners {
+				s = clean(s)
+			}
+			if s == "" {
+				if fm.Required {
+					return nil, reject(fm.empty, fm.Source, &text)
+				}
+				if fm.fallback.IsValid() {
+					out.Field(fm.target).Set(fm.fallback)
+				}
+				continue
+			}
+			if len(fm.Values) > 0 {
+				if mapped, ok := fm.Values[s]; ok {
+					s = mapped
+				} else if fm.Unmapped != "" {
+					logger.Warn("app.Mapping.Apply: unmapped value", "field", fm.Source, "value", s, "rawStore", rawStore)
+					s = fm.Unmapped
+				}
+			}
+			value = s
+		}
+
+		v, err := fm.convert(value)
+		if err == nil && !fm.check(v) {
+			err = fmt.Errorf("failed checks %v: %v", fm.Checks, value)
+		}
+		if err != nil {
+			if fm.Required {
+				return nil, reject(fm.invalid, fm.Source, &text)
+			}
+			logger.Warn("app.Mapping.Apply: invalid value", "error", err, "field", fm.Source, "rawStore", rawStore)
+			continue
+		}
+		out.Field(fm.target).Set(v)
+	}
+
+	checkCoordinates(store, rawStore)
+
+	return store, nil
+}
+
+// convert turns a cleaned string, a bool or a float64 into a value of the
+// target field type.
+func (fm *fieldMapper) convert(value any) (reflect.Value, error) {
+	t := modelStoreType.Field(fm.target).Type
+
+	var (
+		v   any
+		err error
+	)
+	switch fm.kind {
+	case stringTarget:
+		switch x := value.(type) {
+		case string:
+			v = x
+		case bool:
+			v = strconv.FormatBool(x)
+		case float64:
+			v = strconv.FormatFloat(x, 'f', -1, 64)
+		}
+		return reflect.ValueOf(v).Convert(t), nil
+	case intTarget:
+		switch x := value.(type) {
+		case string:
+			v, err = strconv.Atoi(x)
+		case float64:
+			if x != float64(int(x)) {
+				err = fmt.Errorf("not an integer: %v", x)
+			}
+			v = int(x)
+		default:
+			err = fmt.Errorf("unexpected %T", value)
+		}
+	case boolTarget:
+		switch x := value.(type) {
+		case string:
+			v, err = strconv.ParseBool(x)
+		case bool:
+			v = x
+		default:
+			err = fmt.Errorf("unexpected %T", value)
+		}
+	case floatTarget:
+		var f float64
+		switch x := value.(type) {
+		case string:
+			f, err = strconv.ParseFloat(x, 64)
+		case float64:
+			f = x
+		default:
+			err = fmt.Errorf("unexpected %T", value)
+		}
+		v = &f
+	case timeTarget:
+		var tm time.Time
+		if s, ok := value.(string); ok {
+			tm, err = utils.ParseTimeString(s)
+		} else {
+			err = fmt.Errorf("unexpected %T", value)
+		}
+		v = &tm
+	}
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	return reflect.ValueOf(v), nil
+}
+
+func (fm *fieldMapper) check(v reflect.Value) bool {
+	var f float64
+	switch fm.kind {
+	case intTarget:
+		f = float64(v.Int())
+	case floatTarget:
+		f = v.Elem().Float()
+	default:
+		return true
+	}
+
+	for _, check := range fm.checks {
+		if !check(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// rawText renders an ESB value for a rejection.
+func rawText(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// checkCoordinates keeps coordinates only as a valid pair that is not 0,0.
+func checkCoordinates(store *model.Store, rawStore esb.Store) {
+	lat, lon := store.Latitude, store.Longitude
+	if lat == nil && lon == nil {
+		return
+	}
+	if lat == nil || lon == nil || *lat == 0 && *lon == 0 {
+		logger.Warn("app.checkCoordinates: invalid store coordinates", "latitude", rawStore.Latitude, "longitude", rawStore.Longitude, "rawStore", rawStore)
+		store.Latitude, store.Longitude = nil, nil
+	}
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"go-esb-store/internal/model"
+	"go-esb-store/internal/ydb"
+)
+
+// memStorage is an in-memory storage with the semantics of ydb.Client. A
+// replayed run reads the recorded YDB state from it, see
+// loadCassetteStorage; tests use it in place of YDB.
+type memStorage struct {
+	stores     map[storeKey]model.Store
+	states     map[string]model.SyncState
+	rejections []model.Rejection
+	rows       map[string]map[string]ydb.Row
+	dicts      map[ydb.Dictionary]map[string]model.DictionaryEntry
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{
+		stores: make(map[storeKey]model.Store),
+		states: make(map[string]model.SyncState),
+		rows:   make(map[string]map[string]ydb.Row),
+		dicts:  make(map[ydb.Dictionary]map[string]model.DictionaryEntry),
+	}
+}
+
+func (m *memStorage) GetSyncState(_ context.Context, name string) (*model.SyncState, error) {
+	state, ok := m.states[name]
+	if !ok {
+		state = model.SyncState{Name: name}
+	}
+	return &state, nil
+}
+
+func (m *memStorage) SetSyncState(_ context.Context, state *model.SyncState) error {
+	m.states[state.Name] = *state
+	return nil
+}
+
+func (m *memStorage) SetStores(_ context.Context, stores []model.Store) error {
+	for _, s := range stores {
+		m.stores[keyOf(s)] = s
+	}
+	return nil
+}
+
+func (m *memStorage) DeleteStoresNotSyncedSince(_ context.Context, since time.Time, countries []string, keep []model.StoreKey) error {
+	for k, s := range m.stores {
+		kept := slices.Contains(keep, model.StoreKey{Country: s.Country, Number: s.Number})
+		if !kept && !s.SyncedAt.IsZero() && s.SyncedAt.Before(since) && (len(countries) == 0 || slices.Contains(countries, s.Country)) {
+			delete(m.stores, k)
+		}
+	}
+	return nil
+}
+
+func (m *memStorage) SetRejections(_ context.Context, _ time.Time, rejections []model.Rejection) error {
+	m.rejections = append(m.rejections, rejections...)
+	return nil
+}
+
+func (m *memStorage) UpsertRows(_ context.Context, t *ydb.Table, rows []ydb.Row) error {
+	table, ok := m.rows[t.Name]
+	if !ok {
+		table = make(map[string]ydb.Row)
+		m.rows[t.Name] = table
+	}
+	for _, row := range rows {
+		table[rowKey(t, row)] = row
+	}
+	return nil
+}
+
+// rowKey joins the key columns of a row of t.
+func rowKey(t *ydb.Table, row ydb.Row) string {
+	key := make([]string, 0, len(t.Key))
+	for _, k := range t.Key {
+		key = append(key, fmt.Sprint(row[k]))
+	}
+	return strings.Join(key, "/")
+}
+
+func (m *memStorage) DeleteRowsNotSyncedSince(_ context.Context, t *ydb.Table, since time.Time, keep []ydb.Row) error {
+	kept := make(map[string]bool, len(keep))
+	for _, row := range keep {
+		kept[rowKey(t, row)] = true
+	}
+	for k, row := range m.rows[t.Name] {
+		if syncedAt, ok := row[ydb.SyncedAtColumn].(time.Time); ok && syncedAt.Before(since) && !kept[k] {
+			delete(m.rows[t.Name], k)
+		}
+	}
+	return nil
+}
+
+func (m *memStorage) SeedDictionary(_ context.Context, d ydb.Dictionary, entries []model.DictionaryEntry) error {
+	dict, ok := m.dicts[d]
+	if !ok {
+		dict = make(map[string]model.DictionaryEntry)
+		m.dicts[d] = dict
+	}
+	for _, e := range entries {
+		if _, ok := dict[e.Code]; !ok {
+			dict[e.Code] = e
+		}
+	}
+	return nil
+}
+
+func (m *memStorage) GetDictionary(_ context.Context, d ydb.Dictionary) (map[string]model.DictionaryEntry, error) {
+	return maps.Clone(m.dicts[d]), nil
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-esb-store/internal/esb"
+	"go-esb-store/internal/model"
+	"go-esb-store/internal/utils"
+)
+
+// RejectError is why rawToModelStore dropped a store: Rule is one of the
+// Err* sentinels, Value the raw value of Field, nil if it was missing.
+type RejectError struct {
+	Rule  error
+	Field string
+	Value *string
+}
+
+func (e *RejectError) Error() string {
+	if e.Value == nil {
+		return e.Rule.Error()
+	}
+	return fmt.Sprintf("%s: %q", e.Rule, *e.Value)
+}
+
+func (e *RejectError) Unwrap() error {
+	return e.Rule
+}
+
+func reject(rule error, field string, value *string) *RejectError {
+	return &RejectError{Rule: rule, Field: field, Value: value}
+}
+
+// storesEntity names the stores sync in rejections.
+const storesEntity = "stores"
+
+// newRejection records a store dropped with err.
+func newRejection(rawStore esb.Store, err error) model.Rejection {
+	r := rejection(storesEntity, err)
+	if rawStore.StoreFactsNumber != nil {
+		r.Number = utils.CleanString(*rawStore.StoreFactsNumber)
+	}
+
+	if b, e := json.Marshal(rawStore); e == nil {
+		r.Record = string(b)
+	}
+
+	return r
+}
+
+// newRejection records a record of the entity dropped with err, numbered
+// by its key.
+func (e *Entity) newRejection(rec esb.Record, err error) model.Rejection {
+	r := rejection(e.Name, err)
+	if key, ok := e.keyRow(rec); ok {
+		parts := make([]string, 0, len(key))
+		for _, f := range e.Fields {
+			if f.Key {
+				parts = append(parts, fmt.Sprint(key[f.Column]))
+			}
+		}
+		r.Number = strings.Join(parts, "/")
+	}
+
+	if b, e := json.Marshal(rec); e == nil {
+		r.Record = string(b)
+	}
+
+	return r
+}
+
+// rejection starts the rejection of a record of entity dropped with err.
+// Errors other than a *RejectError are recorded with their message as the
+// rule.
+func rejection(entity string, err error) model.Rejection {
+	r := model.Rejection{Entity: entity, Rule: err.Error()}
+
+	var rejectErr *RejectError
+	if errors.As(err, &rejectErr) {
+		r.Rule = rejectErr.Rule.Error()
+		r.Field = rejectErr.Field
+		r.Value = rejectErr.Value
+	}
+
+	return r
+}
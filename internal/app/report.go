@@ -0,0 +1,187 @@
+package app
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go-esb-store/internal/esb"
+	"go-esb-store/internal/model"
+)
+
+// maxRejectedNumbers caps the store numbers or record keys listed per rule
+// in the summary.
+const maxRejectedNumbers = 10
+
+// maxConflicts caps the duplicate store numbers listed in the summary, which
+// has to fit in a Telegram message.
+const maxConflicts = 20
+
+// Report summarizes a sync run.
+type Report struct {
+	Full   bool
+	Synced int
+	// RunID names the archive of the raw ESB pages, if archiving is on.
+	RunID string
+	// FailedPages lists the ESB pages that failed in partial mode. A run
+	// with failed pages is incomplete: what was fetched is upserted, but
+	// stale stores are not deleted and the sync state is not advanced.
+	FailedPages []int
+	// Drift is how the ESB records of the run differ from api.yaml.
+	Drift *esb.Drift
+	// Rejected lists the stores dropped because they failed conversion.
+	Rejected []model.Rejection
+	// Conflicts lists the records repeating a store number ESB returned
+	// before, and whether the duplicate policy kept them.
+	Conflicts []Conflict
+	// UnknownCodes lists the brand and format codes of synced stores that
+	// are not in their dictionaries or are inactive there.
+	UnknownCodes []UnknownCode
+	// Entities reports the entity syncs of the run, in APP_ENTITIES order.
+	Entities []*EntityReport
+}
+
+// EntityReport summarizes the sync of one entity. Failed pages leave it
+// incomplete, and its stale rows are not deleted then.
+type EntityReport struct {
+	Name        string
+	Synced      int
+	FailedPages []int
+	// Rejected lists the records dropped because they failed conversion.
+	Rejected []model.Rejection
+}
+
+// NeedsAttention reports whether the run should be brought to someone's
+// notice even though it did not fail.
+func (r *Report) NeedsAttention() bool {
+	if r.Incomplete() || !r.Drift.Empty() || len(r.Rejected) > 0 || len(r.Conflicts) > 0 || len(r.UnknownCodes) > 0 {
+		return true
+	}
+	for _, e := range r.Entities {
+		if len(e.Rejected) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Incomplete reports whether some ESB pages were not synced.
+func (r *Report) Incomplete() bool {
+	if len(r.FailedPages) > 0 {
+		return true
+	}
+	for _, e := range r.Entities {
+		if len(e.FailedPages) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Report) String() string {
+	mode := "delta"
+	if r.Full {
+		mode = "full"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s sync: %d stores", mode, r.Synced)
+	if r.RunID != "" {
+		fmt.Fprintf(&b, "\narchive run: %s", r.RunID)
+	}
+	if len(r.FailedPages) > 0 {
+		fmt.Fprintf(&b, "\nincomplete, failed pages: %s", joinPages(r.FailedPages))
+	}
+	if len(r.Rejected) > 0 {
+		b.WriteString("\n" + rejectedSummary(storesEntity, r.Rejected))
+	}
+	if len(r.Conflicts) > 0 {
+		b.WriteString("\n" + r.conflictsSummary())
+	}
+	if len(r.UnknownCodes) > 0 {
+		b.WriteString("\n" + r.unknownCodesSummary())
+	}
+	for _, e := range r.Entities {
+		fmt.Fprintf(&b, "\n%s: %d records", e.Name, e.Synced)
+		if len(e.FailedPages) > 0 {
+			fmt.Fprintf(&b, ", incomplete, failed pages: %s", joinPages(e.FailedPages))
+		}
+		if len(e.Rejected) > 0 {
+			b.WriteString("\n" + rejectedSummary(e.Name, e.Rejected))
+		}
+	}
+	if !r.Drift.Empty() {
+		b.WriteString("\n" + r.Drift.String())
+	}
+
+	return b.String()
+}
+
+func joinPages(pages []int) string {
+	pages = slices.Clone(pages)
+	slices.Sort(pages)
+
+	failed := make([]string, 0, len(pages))
+	for _, p := range pages {
+		failed = append(failed, strconv.Itoa(p))
+	}
+	return strings.Join(failed, ", ")
+}
+
+// rejectedSummary counts the rejected records of entity by rule, listing
+// some of the store numbers or record keys of each rule.
+func rejectedSummary(entity string, rejected []model.Rejection) string {
+	var (
+		rules   []string
+		numbers = make(map[string][]string)
+		counts  = make(map[string]int)
+	)
+	for _, rej := range rejected {
+		if _, ok := counts[rej.Rule]; !ok {
+			rules = append(rules, rej.Rule)
+		}
+		counts[rej.Rule]++
+		if rej.Number != "" && len(numbers[rej.Rule]) < maxRejectedNumbers {
+			numbers[rej.Rule] = append(numbers[rej.Rule], rej.Number)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "rejected %s: %d", entity, len(rejected))
+	for _, rule := range rules {
+		fmt.Fprintf(&b, "\n- %s: %d", rule, counts[rule])
+		if len(numbers[rule]) > 0 {
+			more := ""
+			if counts[rule] > len(numbers[rule]) {
+				more = ", ..."
+			}
+			fmt.Fprintf(&b, " (%s%s)", strings.Join(numbers[rule], ", "), more)
+		}
+	}
+	return b.String()
+}
+
+// conflictsSummary lists the first duplicate store numbers of the run.
+func (r *Report) conflictsSummary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "duplicate store numbers: %d", len(r.Conflicts))
+	for _, c := range r.Conflicts[:min(len(r.Conflicts), maxConflicts)] {
+		b.WriteString("\n- " + c.String())
+	}
+	if more := len(r.Conflicts) - maxConflicts; more > 0 {
+		fmt.Fprintf(&b, "\n- and %d more", more)
+	}
+	return b.String()
+}
+
+// unknownCodesSummary lists the codes missing from the dictionaries or
+// inactive there.
+func (r *Report) unknownCodesSummary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "unknown or inactive codes: %d", len(r.UnknownCodes))
+	for _, u := range r.UnknownCodes {
+		b.WriteString("\n- " + u.String())
+	}
+	return b.String()
+}
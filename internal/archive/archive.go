@@ -0,0 +1,140 @@
+// Package archive keeps the raw ESB page bodies of every run, so a wrong or
+// missing store can be traced back to what ESB actually sent.
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"go-esb-store/internal/config"
+	"go-esb-store/pkg/logger"
+)
+
+type Backend string
+
+const (
+	BackendOff Backend = "off"
+	BackendFS  Backend = "fs"
+	BackendS3  Backend = "s3"
+)
+
+const runIDTimeFormat = "20060102T150405Z"
+
+// Archiver writes the page bodies of one run gzip compressed to
+// <prefix>/<run id>/page-<page>.json.gz.
+type Archiver struct {
+	store     BlobStore
+	prefix    string
+	runID     string
+	retention time.Duration
+}
+
+// New returns an archiver for a new run, or nil if archiving is off.
+func New(cfg *config.Archive) (*Archiver, error) {
+	var store BlobStore
+	switch Backend(cfg.Backend) {
+	case BackendOff:
+		return nil, nil
+	case BackendFS:
+		store = &FSStore{Dir: cfg.Dir}
+	case BackendS3:
+		if cfg.S3Endpoint.Host == "" || cfg.S3Bucket == "" {
+			return nil, fmt.Errorf("%w: endpoint and bucket are required for %s", ErrUnsupportedBackend, BackendS3)
+		}
+		store = &S3Store{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			Client:    &http.Client{Timeout: cfg.Timeout},
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedBackend, cfg.Backend)
+	}
+
+	return &Archiver{
+		store:     store,
+		prefix:    cfg.Prefix,
+		runID:     newRunID(time.Now()),
+		retention: cfg.Retention,
+	}, nil
+}
+
+// RunID identifies the run; run IDs sort by start time.
+func (a *Archiver) RunID() string {
+	return a.runID
+}
+
+// Page archives the raw body of a page. Failures are logged and never stop
+// the sync. A page fetched again, e.g. on a re-fetch pass, replaces the
+// earlier body.
+func (a *Archiver) Page(ctx context.Context, page int, body []byte) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		logger.Error("archive.Page: failed to compress page", "error", err, "page", page)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		logger.Error("archive.Page: failed to compress page", "error", err, "page", page)
+		return
+	}
+
+	key := path.Join(a.prefix, a.runID, fmt.Sprintf("page-%05d.json.gz", page))
+	if err := a.store.Put(ctx, key, buf.Bytes()); err != nil {
+		logger.Error("archive.Page: failed to archive page", "error", err, "key", key)
+		return
+	}
+	logger.Debug("archive.Page: page archived", "key", key, "size", buf.Len())
+}
+
+// Cleanup deletes archived pages older than the retention period and
+// returns how many were deleted. Zero retention keeps everything.
+func (a *Archiver) Cleanup(ctx context.Context) (int, error) {
+	if a.retention <= 0 {
+		return 0, nil
+	}
+
+	prefix := a.prefix
+	if prefix != "" {
+		prefix += "/"
+	}
+	blobs, err := a.store.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(-a.retention)
+	deleted := 0
+	for _, b := range blobs {
+		if !b.ModTime.Before(deadline) {
+			continue
+		}
+		if err = a.store.Delete(ctx, b.Key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	if p, ok := a.store.(Pruner); ok && deleted > 0 {
+		if err = p.Prune(ctx); err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+func newRunID(now time.Time) string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return now.UTC().Format(runIDTimeFormat) + "-" + hex.EncodeToString(suffix)
+}
@@ -0,0 +1,29 @@
+package archive
+
+import (
+	"context"
+	"time"
+)
+
+// BlobStore keeps archived objects under slash separated keys.
+type BlobStore interface {
+	// Put stores body under key, replacing an existing object.
+	Put(ctx context.Context, key string, body []byte) error
+	// List returns the objects whose keys start with prefix.
+	List(ctx context.Context, prefix string) ([]Blob, error)
+	// Delete removes the object; deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Pruner is implemented by stores that keep structure besides the objects,
+// such as directories, to remove what deletions left empty.
+type Pruner interface {
+	Prune(ctx context.Context) error
+}
+
+// Blob describes a stored object.
+type Blob struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
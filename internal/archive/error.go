@@ -0,0 +1,6 @@
+package archive
+
+import "errors"
+
+var ErrUnsupportedBackend = errors.New("unsupported archive backend")
+var ErrS3 = errors.New("s3 request failed")
@@ -0,0 +1,119 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-esb-store/internal/config"
+)
+
+func newFSArchiver(t *testing.T, dir string, retention time.Duration) *Archiver {
+	t.Helper()
+
+	a, err := New(&config.Archive{Backend: string(BackendFS), Dir: dir, Prefix: "esb", Retention: retention})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return a
+}
+
+func TestFSRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	a := newFSArchiver(t, dir, 0)
+	ctx := context.Background()
+
+	pages := map[int][]byte{
+		0: []byte(`{"value":[{"StoreFactsNumber":"1"}]}`),
+		1: []byte(`{"value":[{"StoreFactsNumber":"2"}]}`),
+	}
+	for page, body := range pages {
+		a.Page(ctx, page, body)
+	}
+	// A page fetched again replaces the earlier body.
+	pages[1] = []byte(`{"value":[{"StoreFactsNumber":"2","NameAlias":"Магазин 2"}]}`)
+	a.Page(ctx, 1, pages[1])
+
+	blobs, err := a.store.List(ctx, "esb/"+a.RunID()+"/")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(blobs) != len(pages) {
+		t.Fatalf("List() = %d blobs, want %d", len(blobs), len(pages))
+	}
+
+	for page, want := range pages {
+		f, err := os.Open(filepath.Join(dir, "esb", a.RunID(), fmt.Sprintf("page-%05d.json.gz", page)))
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		got, err := io.ReadAll(zr)
+		_ = f.Close()
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("page %d = %s, want %s", page, got, want)
+		}
+	}
+
+	if deleted, err := a.Cleanup(ctx); err != nil || deleted != 0 {
+		t.Errorf("Cleanup() = %d, %v, want nothing deleted without retention", deleted, err)
+	}
+}
+
+func TestFSRetention(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store := &FSStore{Dir: dir}
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, key := range []string{"esb/old-run/page-00000.json.gz", "esb/old-run/page-00001.json.gz", "esb/new-run/page-00000.json.gz", "other/old-run/page-00000.json.gz"} {
+		if err := store.Put(ctx, key, []byte("page")); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		if filepath.Base(filepath.Dir(key)) == "old-run" {
+			if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(key)), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	a := newFSArchiver(t, dir, 24*time.Hour)
+	deleted, err := a.Cleanup(ctx)
+	if err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Cleanup() deleted %d, want 2", deleted)
+	}
+
+	for path, want := range map[string]bool{
+		"esb/old-run":                      false,
+		"esb/new-run/page-00000.json.gz":   true,
+		"other/old-run/page-00000.json.gz": true,
+		"":                                 true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+		if exists := err == nil; exists != want {
+			t.Errorf("%q exists = %t, want %t", path, exists, want)
+		}
+	}
+}
+
+func TestFSDeleteMissing(t *testing.T) {
+	store := &FSStore{Dir: t.TempDir()}
+	if err := store.Delete(context.Background(), "esb/run/page-00000.json.gz"); err != nil {
+		t.Errorf("Delete() of a missing object error = %v", err)
+	}
+}
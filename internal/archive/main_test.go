@@ -0,0 +1,14 @@
+package archive
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+
+	"go-esb-store/pkg/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init(slog.LevelError + 1)
+	os.Exit(m.Run())
+}
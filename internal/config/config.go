@@ -15,22 +15,76 @@ import (
 type Config struct {
 	App      App
 	ESB      ESB
+	Archive  Archive
 	Telegram Telegram
 	YDB      YDB
 }
 
 type App struct {
-	Name     string     `env:"APP_NAME" envDefault:"esb"`
-	Version  string     `env:"APP_VERSION" envDefault:"0.0.1"`
-	LogLevel slog.Level `env:"APP_LOG_LEVEL" envDefault:"info"`
-	Mode     model.Mode `env:"APP_MODE" envDefault:"prod"`
+	Name             string                `env:"APP_NAME" envDefault:"esb"`
+	Version          string                `env:"APP_VERSION" envDefault:"0.0.1"`
+	LogLevel         slog.Level            `env:"APP_LOG_LEVEL" envDefault:"info"`
+	Mode             model.Mode            `env:"APP_MODE" envDefault:"prod"`
+	SyncMode         model.SyncMode        `env:"APP_SYNC_MODE" envDefault:"full"`
+	FullSyncInterval time.Duration         `env:"APP_FULL_SYNC_INTERVAL" envDefault:"168h"`
+	DeleteStale      bool                  `env:"APP_DELETE_STALE" envDefault:"false"`
+	Entities         []string              `env:"APP_ENTITIES"`
+	EntitiesFile     string                `env:"APP_ENTITIES_FILE"`
+	MaxRejected      int                   `env:"APP_MAX_REJECTED" envDefault:"0"`
+	DuplicatePolicy  model.DuplicatePolicy `env:"APP_DUPLICATE_POLICY" envDefault:"open"`
+	MappingFile      string                `env:"APP_MAPPING_FILE"`
 }
 
 type ESB struct {
-	BaseURL       url.URL       `env:"ESB_BASE_URL" required:"true"`
-	APIKey        string        `env:"ESB_API_KEY" required:"true"`
-	Timeout       time.Duration `env:"ESB_TIMEOUT" envDefault:"60s"`
-	LimitPageSize int           `env:"ESB_LIMIT_PAGE_SIZE" envDefault:"100"`
+	BaseURLs            []url.URL     `env:"ESB_BASE_URL" required:"true"`
+	Auth                string        `env:"ESB_AUTH" envDefault:"bearer"`
+	APIKey              string        `env:"ESB_API_KEY"`
+	Username            string        `env:"ESB_USERNAME"`
+	Password            string        `env:"ESB_PASSWORD"`
+	OAuthTokenURL       url.URL       `env:"ESB_OAUTH_TOKEN_URL"`
+	OAuthClientID       string        `env:"ESB_OAUTH_CLIENT_ID"`
+	OAuthClientSecret   string        `env:"ESB_OAUTH_CLIENT_SECRET"`
+	OAuthScopes         []string      `env:"ESB_OAUTH_SCOPES"`
+	OAuthRefreshBefore  time.Duration `env:"ESB_OAUTH_REFRESH_BEFORE" envDefault:"60s"`
+	Timeout             time.Duration `env:"ESB_TIMEOUT" envDefault:"60s"`
+	CAFile              string        `env:"ESB_CA_FILE"`
+	ClientCertFile      string        `env:"ESB_CLIENT_CERT_FILE"`
+	ClientKeyFile       string        `env:"ESB_CLIENT_KEY_FILE"`
+	ProxyURL            url.URL       `env:"ESB_PROXY_URL"`
+	TLSMinVersion       string        `env:"ESB_TLS_MIN_VERSION" envDefault:"1.2"`
+	MaxIdleConns        int           `env:"ESB_MAX_IDLE_CONNS" envDefault:"100"`
+	MaxIdleConnsPerHost int           `env:"ESB_MAX_IDLE_CONNS_PER_HOST"`
+	MaxConnsPerHost     int           `env:"ESB_MAX_CONNS_PER_HOST"`
+	IdleConnTimeout     time.Duration `env:"ESB_IDLE_CONN_TIMEOUT" envDefault:"90s"`
+	LimitPageSize       int           `env:"ESB_LIMIT_PAGE_SIZE" envDefault:"100"`
+	MaxConcurrency      int           `env:"ESB_MAX_CONCURRENCY" envDefault:"4"`
+	Countries           []string      `env:"ESB_COUNTRIES" envDefault:"RUS"`
+	Filter              string        `env:"ESB_FILTER"`
+	SelectExtra         []string      `env:"ESB_SELECT_EXTRA"`
+	RefetchAttempts     int           `env:"ESB_REFETCH_ATTEMPTS" envDefault:"1"`
+	Partial             bool          `env:"ESB_PARTIAL" envDefault:"false"`
+	Validate            bool          `env:"ESB_VALIDATE" envDefault:"false"`
+	Pagination          string        `env:"ESB_PAGINATION" envDefault:"skip"`
+	RateLimit           float64       `env:"ESB_RATE_LIMIT" envDefault:"0"`
+	RateBurst           int           `env:"ESB_RATE_BURST" envDefault:"1"`
+	RetryAttempts       int           `env:"ESB_RETRY_ATTEMPTS" envDefault:"3"`
+	RetryDelay          time.Duration `env:"ESB_RETRY_DELAY" envDefault:"500ms"`
+	RetryMaxDelay       time.Duration `env:"ESB_RETRY_MAX_DELAY" envDefault:"30s"`
+	CassetteMode        string        `env:"ESB_CASSETTE_MODE" envDefault:"off"`
+	CassetteDir         string        `env:"ESB_CASSETTE_DIR" envDefault:"cassettes"`
+}
+
+type Archive struct {
+	Backend     string        `env:"ARCHIVE_BACKEND" envDefault:"off"`
+	Prefix      string        `env:"ARCHIVE_PREFIX" envDefault:"esb"`
+	Retention   time.Duration `env:"ARCHIVE_RETENTION" envDefault:"720h"`
+	Dir         string        `env:"ARCHIVE_DIR" envDefault:"archive"`
+	S3Endpoint  url.URL       `env:"ARCHIVE_S3_ENDPOINT"`
+	S3Region    string        `env:"ARCHIVE_S3_REGION" envDefault:"ru-central1"`
+	S3Bucket    string        `env:"ARCHIVE_S3_BUCKET"`
+	S3AccessKey string        `env:"ARCHIVE_S3_ACCESS_KEY"`
+	S3SecretKey string        `env:"ARCHIVE_S3_SECRET_KEY"`
+	Timeout     time.Duration `env:"ARCHIVE_TIMEOUT" envDefault:"30s"`
 }
 
 type Telegram struct {
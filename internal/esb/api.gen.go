@@ -30,67 +30,95 @@ const (
 	Refranchised Status = "Refranchised"
 )
 
-// Defines values for GetStoresParamsFilter.
-const (
-	GetStoresParamsFilterPrimaryCountryRegionIdEqRUS GetStoresParamsFilter = "PrimaryCountryRegionId eq 'RUS'"
-)
-
-// Defines values for GetStoresCountParamsFilter.
-const (
-	GetStoresCountParamsFilterPrimaryCountryRegionIdEqRUS GetStoresCountParamsFilter = "PrimaryCountryRegionId eq 'RUS'"
-)
-
 // Status defines model for Status.
 type Status string
 
 // Store defines model for Store.
 type Store struct {
+	// AddressCity City
+	AddressCity *string `json:"AddressCity,omitempty"`
+
+	// AddressState Region
+	AddressState *string `json:"AddressState,omitempty"`
+
 	// BrandId Brand identifier
 	BrandId *string `json:"BrandId,omitempty"`
 
+	// ClosingDate Closing date (ISO 8601)
+	ClosingDate *string `json:"ClosingDate,omitempty"`
+
 	// FacilityShoppingCenterName Mall name
 	FacilityShoppingCenterName *string `json:"FacilityShoppingCenterName,omitempty"`
 
 	// FranchiseePartnerName Company name
 	FranchiseePartnerName *string `json:"FranchiseePartnerName,omitempty"`
 
+	// Latitude Latitude (WGS 84)
+	Latitude *float64 `json:"Latitude,omitempty"`
+
+	// Longitude Longitude (WGS 84)
+	Longitude *float64 `json:"Longitude,omitempty"`
+
+	// ModifiedDateTime Last modification time (ISO 8601)
+	ModifiedDateTime *string `json:"ModifiedDateTime,omitempty"`
+
 	// NameAlias Store name
 	NameAlias *string `json:"NameAlias,omitempty"`
 
+	// OpeningDate Opening date (ISO 8601)
+	OpeningDate *string `json:"OpeningDate,omitempty"`
+
 	// PrimaryAddress Store address
 	PrimaryAddress *string `json:"PrimaryAddress,omitempty"`
-	Status         *Status `json:"Status,omitempty"`
+
+	// PrimaryCountryRegionId Country code
+	PrimaryCountryRegionId *string `json:"PrimaryCountryRegionId,omitempty"`
+
+	// PrimaryPhone Store phone
+	PrimaryPhone *string `json:"PrimaryPhone,omitempty"`
+	Status       *Status `json:"Status,omitempty"`
+
+	// StoreArea Store area, sq. m
+	StoreArea *float64 `json:"StoreArea,omitempty"`
 
 	// StoreFactsNumber Store number
 	StoreFactsNumber *string `json:"StoreFactsNumber,omitempty"`
 
 	// StoreFormatId Store format
 	StoreFormatId *string `json:"StoreFormatId,omitempty"`
+
+	// TemporaryClosed Store is temporarily closed
+	TemporaryClosed *bool `json:"TemporaryClosed,omitempty"`
+
+	// TemporaryClosedReason Reason of temporary closure
+	TemporaryClosedReason *string `json:"TemporaryClosedReason,omitempty"`
 }
 
 // StoreResponse defines model for StoreResponse.
 type StoreResponse struct {
-	Value *[]Store `json:"value,omitempty"`
+	// OdataCount Total number of stores matching the filter
+	OdataCount *int `json:"@odata.count,omitempty"`
+
+	// OdataNextLink Link to the next page of server-driven paging
+	OdataNextLink *string  `json:"@odata.nextLink,omitempty"`
+	Value         *[]Store `json:"value,omitempty"`
 }
 
 // GetStoresParams defines parameters for GetStores.
 type GetStoresParams struct {
-	Filter *GetStoresParamsFilter `form:"filter,omitempty" json:"filter,omitempty"`
-	Skip   *int                   `form:"skip,omitempty" json:"skip,omitempty"`
-	Top    *int                   `form:"top,omitempty" json:"top,omitempty"`
+	Count   *bool   `form:"count,omitempty" json:"count,omitempty"`
+	Filter  *string `form:"filter,omitempty" json:"filter,omitempty"`
+	Orderby *string `form:"orderby,omitempty" json:"orderby,omitempty"`
+	Select  *string `form:"select,omitempty" json:"select,omitempty"`
+	Skip    *int    `form:"skip,omitempty" json:"skip,omitempty"`
+	Top     *int    `form:"top,omitempty" json:"top,omitempty"`
 }
 
-// GetStoresParamsFilter defines parameters for GetStores.
-type GetStoresParamsFilter string
-
 // GetStoresCountParams defines parameters for GetStoresCount.
 type GetStoresCountParams struct {
-	Filter *GetStoresCountParamsFilter `form:"filter,omitempty" json:"filter,omitempty"`
+	Filter *string `form:"filter,omitempty" json:"filter,omitempty"`
 }
 
-// GetStoresCountParamsFilter defines parameters for GetStoresCount.
-type GetStoresCountParamsFilter string
-
 // RequestEditorFn  is the function signature for the RequestEditor callback function
 type RequestEditorFn func(ctx context.Context, req *http.Request) error
 
@@ -217,6 +245,22 @@ func NewGetStoresRequest(server string, params *GetStoresParams) (*http.Request,
 	if params != nil {
 		queryValues := queryURL.Query()
 
+		if params.Count != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "count", runtime.ParamLocationQuery, *params.Count); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
 		if params.Filter != nil {
 
 			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "filter", runtime.ParamLocationQuery, *params.Filter); err != nil {
@@ -233,6 +277,38 @@ func NewGetStoresRequest(server string, params *GetStoresParams) (*http.Request,
 
 		}
 
+		if params.Orderby != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "orderby", runtime.ParamLocationQuery, *params.Orderby); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
+		if params.Select != nil {
+
+			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "select", runtime.ParamLocationQuery, *params.Select); err != nil {
+				return nil, err
+			} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+				return nil, err
+			} else {
+				for k, v := range parsed {
+					for _, v2 := range v {
+						queryValues.Add(k, v2)
+					}
+				}
+			}
+
+		}
+
 		if params.Skip != nil {
 
 			if queryFrag, err := runtime.StyleParamWithLocation("form", true, "skip", runtime.ParamLocationQuery, *params.Skip); err != nil {
@@ -0,0 +1,257 @@
+package esb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go-esb-store/internal/config"
+	"go-esb-store/pkg/logger"
+)
+
+type AuthMode string
+
+const (
+	AuthBearer AuthMode = "bearer"
+	AuthBasic  AuthMode = "basic"
+	AuthOAuth2 AuthMode = "oauth2"
+)
+
+const (
+	defaultTokenRefreshBefore = time.Minute
+	// defaultTokenLifetime is assumed for tokens issued without expires_in,
+	// which RFC 6749 only recommends.
+	defaultTokenLifetime = 5 * time.Minute
+)
+
+// Authenticator sets credentials on outgoing ESB requests.
+type Authenticator interface {
+	// Authenticate adds credentials to req.
+	Authenticate(ctx context.Context, req *http.Request) error
+	// Invalidate drops cached credentials after the server rejected them.
+	Invalidate()
+}
+
+// BearerAuth sends a static bearer token.
+type BearerAuth struct {
+	Token string
+}
+
+func (a *BearerAuth) Authenticate(_ context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.Token))
+	return nil
+}
+
+func (a *BearerAuth) Invalidate() {}
+
+// BasicAuth sends HTTP basic credentials.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a *BasicAuth) Authenticate(_ context.Context, req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+func (a *BasicAuth) Invalidate() {}
+
+// OAuth2ClientCredentials obtains bearer tokens with the OAuth2 client
+// credentials grant. Tokens are cached and refreshed RefreshBefore their
+// expiry, but no earlier than half their lifetime, so a long sync never sends
+// a token that is about to lapse and short-lived tokens are still reused.
+// A token without expires_in is taken to live defaultTokenLifetime.
+type OAuth2ClientCredentials struct {
+	TokenURL      string
+	ClientID      string
+	ClientSecret  string
+	Scopes        []string
+	RefreshBefore time.Duration
+	Doer          HttpRequestDoer
+
+	mu       sync.Mutex
+	token    string
+	expiry   time.Time
+	lifetime time.Duration
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func (a *OAuth2ClientCredentials) Authenticate(ctx context.Context, req *http.Request) error {
+	token, err := a.Token(ctx)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return nil
+}
+
+func (a *OAuth2ClientCredentials) Invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.token = ""
+	a.expiry = time.Time{}
+	a.lifetime = 0
+}
+
+// Token returns the cached access token, requesting a new one if the cached
+// token is missing or expires within RefreshBefore.
+func (a *OAuth2ClientCredentials) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	refreshBefore := a.RefreshBefore
+	if refreshBefore <= 0 {
+		refreshBefore = defaultTokenRefreshBefore
+	}
+	refreshBefore = min(refreshBefore, a.lifetime/2)
+	if a.token != "" && time.Now().Add(refreshBefore).Before(a.expiry) {
+		return a.token, nil
+	}
+
+	res, err := a.requestToken(ctx)
+	if err != nil {
+		logger.Error("esb.OAuth2ClientCredentials.Token: token request failed", "error", err)
+		return "", err
+	}
+
+	a.token = res.AccessToken
+	a.lifetime = time.Duration(res.ExpiresIn) * time.Second
+	if a.lifetime <= 0 {
+		a.lifetime = defaultTokenLifetime
+	}
+	a.expiry = time.Now().Add(a.lifetime)
+	logger.Debug("esb.OAuth2ClientCredentials.Token: token refreshed", "expiry", a.expiry)
+
+	return a.token, nil
+}
+
+func (a *OAuth2ClientCredentials) requestToken(ctx context.Context) (*tokenResponse, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+
+	doer := a.Doer
+	if doer == nil {
+		doer = http.DefaultClient
+	}
+
+	rsp, err := doer.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenRequest, err)
+	}
+	defer func() { _ = rsp.Body.Close() }()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %w: %s", ErrTokenRequest, ErrUnexpectedStatus, rsp.Status)
+	}
+
+	var res tokenResponse
+	if err = json.NewDecoder(rsp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenRequest, err)
+	}
+	if res.AccessToken == "" {
+		return nil, fmt.Errorf("%w: empty access token", ErrTokenRequest)
+	}
+	if res.TokenType != "" && !strings.EqualFold(res.TokenType, "bearer") {
+		return nil, fmt.Errorf("%w: unsupported token type %q", ErrTokenRequest, res.TokenType)
+	}
+
+	return &res, nil
+}
+
+// authDoer authenticates every request and, on 401, drops the cached
+// credentials and retries exactly once with fresh ones.
+type authDoer struct {
+	next HttpRequestDoer
+	auth Authenticator
+}
+
+func newAuthDoer(next HttpRequestDoer, auth Authenticator) *authDoer {
+	return &authDoer{
+		next: next,
+		auth: auth,
+	}
+}
+
+func (d *authDoer) Do(req *http.Request) (*http.Response, error) {
+	res, err := d.do(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	logger.Warn("esb.authDoer.Do: unauthorized, retrying with fresh credentials", "url", req.URL.Path)
+	drainBody(res)
+	d.auth.Invalidate()
+
+	return d.do(req)
+}
+
+func (d *authDoer) do(req *http.Request) (*http.Response, error) {
+	r, err := cloneRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.auth.Authenticate(r.Context(), r); err != nil {
+		return nil, err
+	}
+
+	return d.next.Do(r)
+}
+
+// newAuthenticator returns the authenticator of the ESB_AUTH mode, failing
+// if the credentials that mode needs are not set.
+func newAuthenticator(cfg *config.ESB, doer HttpRequestDoer) (Authenticator, error) {
+	mode := AuthMode(cfg.Auth)
+	missing := func(vars ...string) error {
+		return fmt.Errorf("%w: %s needs %s", ErrMissingCredentials, mode, strings.Join(vars, ", "))
+	}
+
+	switch mode {
+	case AuthBearer:
+		if cfg.APIKey == "" {
+			return nil, missing("ESB_API_KEY")
+		}
+		return &BearerAuth{Token: cfg.APIKey}, nil
+	case AuthBasic:
+		if cfg.Username == "" || cfg.Password == "" {
+			return nil, missing("ESB_USERNAME", "ESB_PASSWORD")
+		}
+		return &BasicAuth{Username: cfg.Username, Password: cfg.Password}, nil
+	case AuthOAuth2:
+		if cfg.OAuthTokenURL.Host == "" || cfg.OAuthClientID == "" || cfg.OAuthClientSecret == "" {
+			return nil, missing("ESB_OAUTH_TOKEN_URL", "ESB_OAUTH_CLIENT_ID", "ESB_OAUTH_CLIENT_SECRET")
+		}
+		return &OAuth2ClientCredentials{
+			TokenURL:      cfg.OAuthTokenURL.String(),
+			ClientID:      cfg.OAuthClientID,
+			ClientSecret:  cfg.OAuthClientSecret,
+			Scopes:        cfg.OAuthScopes,
+			RefreshBefore: cfg.OAuthRefreshBefore,
+			Doer:          doer,
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAuth, cfg.Auth)
+	}
+}
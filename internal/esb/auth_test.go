@@ -0,0 +1,98 @@
+package esb
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"go-esb-store/internal/config"
+	"go-esb-store/internal/esb/esbtest"
+)
+
+func TestOAuth2TokenIsReused(t *testing.T) {
+	tests := []struct {
+		name          string
+		ttl           time.Duration
+		omitExpiresIn bool
+	}{
+		{name: "long lived", ttl: time.Hour},
+		{name: "shorter than refresh margin", ttl: 30 * time.Second},
+		{name: "without expires_in", ttl: time.Hour, omitExpiresIn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := esbtest.NewTokenServer("id", "secret", tt.ttl)
+			defer srv.Close()
+			srv.OmitExpiresIn = tt.omitExpiresIn
+
+			auth := &OAuth2ClientCredentials{
+				TokenURL:      srv.TokenURL(),
+				ClientID:      "id",
+				ClientSecret:  "secret",
+				RefreshBefore: time.Minute,
+			}
+
+			first, err := auth.Token(context.Background())
+			if err != nil {
+				t.Fatalf("Token() error = %v", err)
+			}
+			for range 5 {
+				token, err := auth.Token(context.Background())
+				if err != nil {
+					t.Fatalf("Token() error = %v", err)
+				}
+				if token != first {
+					t.Fatal("Token() requested a new token for a fresh one")
+				}
+			}
+			if n := srv.Requests(); n != 1 {
+				t.Errorf("token requests = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestOAuth2TokenWithoutExpiresInExpires(t *testing.T) {
+	srv := esbtest.NewTokenServer("id", "secret", time.Hour)
+	defer srv.Close()
+	srv.OmitExpiresIn = true
+
+	auth := &OAuth2ClientCredentials{TokenURL: srv.TokenURL(), ClientID: "id", ClientSecret: "secret"}
+	if _, err := auth.Token(context.Background()); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if auth.lifetime != defaultTokenLifetime {
+		t.Errorf("lifetime = %s, want %s", auth.lifetime, defaultTokenLifetime)
+	}
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	tokenURL, _ := url.Parse("https://auth.example/token")
+
+	tests := []struct {
+		name    string
+		cfg     config.ESB
+		wantErr error
+	}{
+		{name: "bearer", cfg: config.ESB{Auth: "bearer", APIKey: "key"}},
+		{name: "bearer without key", cfg: config.ESB{Auth: "bearer"}, wantErr: ErrMissingCredentials},
+		{name: "basic", cfg: config.ESB{Auth: "basic", Username: "u", Password: "p"}},
+		{name: "basic without password", cfg: config.ESB{Auth: "basic", Username: "u"}, wantErr: ErrMissingCredentials},
+		{name: "oauth2", cfg: config.ESB{Auth: "oauth2", OAuthTokenURL: *tokenURL, OAuthClientID: "id", OAuthClientSecret: "secret"}},
+		{name: "oauth2 without url", cfg: config.ESB{Auth: "oauth2", OAuthClientID: "id", OAuthClientSecret: "secret"}, wantErr: ErrMissingCredentials},
+		{name: "oauth2 without secret", cfg: config.ESB{Auth: "oauth2", OAuthTokenURL: *tokenURL, OAuthClientID: "id"}, wantErr: ErrMissingCredentials},
+		{name: "unknown mode", cfg: config.ESB{Auth: "kerberos"}, wantErr: ErrUnsupportedAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newAuthenticator(&tt.cfg, nil)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Errorf("newAuthenticator() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
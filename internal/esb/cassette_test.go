@@ -0,0 +1,71 @@
+package esb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"go-esb-store/internal/esb/esbtest"
+)
+
+func TestCassetteKeyIgnoresWatermark(t *testing.T) {
+	key := func(filter string) string {
+		req, _ := http.NewRequest(http.MethodGet, "https://esb.example/RetailStoresESB?"+url.Values{"filter": {filter}, "top": {"100"}}.Encode(), nil)
+		return cassetteKey(req)
+	}
+
+	base := "PrimaryCountryRegionId eq 'RUS'"
+	monday := key("(" + base + ") and ModifiedDateTime ge 2024-11-04T03:20:00Z")
+	tuesday := key("(" + base + ") and ModifiedDateTime ge 2024-11-05T03:20:00Z")
+	if monday != tuesday {
+		t.Error("requests differing in the watermark have different keys")
+	}
+	if monday == key(base) {
+		t.Error("delta and full requests have the same key")
+	}
+	if key(base) == key("PrimaryCountryRegionId eq 'KAZ'") {
+		t.Error("requests with different filters have the same key")
+	}
+}
+
+func TestCassetteReplay(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 150))
+	dir := t.TempDir()
+
+	vars := map[string]string{
+		"ESB_BASE_URL":       srv.URL,
+		"ESB_API_KEY":        "key",
+		"ESB_CASSETTE_MODE":  string(CassetteRecord),
+		"ESB_CASSETTE_DIR":   dir,
+		"ESB_RETRY_ATTEMPTS": "1",
+	}
+	rec, err := NewESBClient(testConfig(t, vars), nil)
+	if err != nil {
+		t.Fatalf("NewESBClient() error = %v", err)
+	}
+	recorded, err := rec.ModifiedSince(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)).GetStores(context.Background())
+	if err != nil {
+		t.Fatalf("GetStores() error = %v", err)
+	}
+	srv.Close()
+
+	vars["ESB_CASSETTE_MODE"] = string(CassetteReplay)
+	rep, err := NewESBClient(testConfig(t, vars), nil)
+	if err != nil {
+		t.Fatalf("NewESBClient() error = %v", err)
+	}
+	replayed, err := rep.ModifiedSince(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)).GetStores(context.Background())
+	if err != nil {
+		t.Fatalf("replayed GetStores() error = %v", err)
+	}
+	if len(replayed) != len(recorded) {
+		t.Errorf("replayed %d stores, recorded %d", len(replayed), len(recorded))
+	}
+
+	if _, err = rep.GetStores(context.Background()); !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("GetStores() of an unrecorded request error = %v, want %v", err, ErrCassetteMiss)
+	}
+}
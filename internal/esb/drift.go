@@ -0,0 +1,204 @@
+package esb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"go-esb-store/pkg/logger"
+)
+
+// maxEnumValues caps the unknown values kept per field, so a field that
+// turned into free text does not flood the report.
+const maxEnumValues = 10
+
+// Drift is how the records ESB sent differ from the Store schema in
+// api.yaml. All lists are sorted.
+type Drift struct {
+	// New lists fields ESB sent that the schema does not describe.
+	New []FieldDrift
+	// Missing lists schema fields absent from every record.
+	Missing []FieldDrift
+	// TypeChanged lists fields whose values are not of the schema type.
+	TypeChanged []FieldDrift
+	// UnknownEnum lists values outside the enum of a field.
+	UnknownEnum []FieldDrift
+}
+
+// FieldDrift describes one drifted field. Expected is the schema type or,
+// for enums, the allowed values; Got is what ESB sent.
+type FieldDrift struct {
+	Field    string
+	Expected string
+	Got      string
+}
+
+// Empty reports whether the records matched the schema.
+func (d *Drift) Empty() bool {
+	return d == nil || len(d.New)+len(d.Missing)+len(d.TypeChanged)+len(d.UnknownEnum) == 0
+}
+
+func (d *Drift) String() string {
+	if d.Empty() {
+		return "no schema drift"
+	}
+
+	var b strings.Builder
+	b.WriteString("schema drift:")
+	for _, f := range d.New {
+		fmt.Fprintf(&b, "\n+ %s (%s)", f.Field, f.Got)
+	}
+	for _, f := range d.Missing {
+		fmt.Fprintf(&b, "\n- %s (%s)", f.Field, f.Expected)
+	}
+	for _, f := range d.TypeChanged {
+		fmt.Fprintf(&b, "\n~ %s: %s -> %s", f.Field, f.Expected, f.Got)
+	}
+	for _, f := range d.UnknownEnum {
+		fmt.Fprintf(&b, "\n? %s: %s", f.Field, f.Got)
+	}
+	return b.String()
+}
+
+// DriftDetector inspects raw store pages for schema drift over a run. Page
+// matches ClientWithDefaults.OnPageBody and is safe for concurrent use.
+type DriftDetector struct {
+	fields map[string]FieldSchema
+
+	mu sync.Mutex
+	// sampled counts the records of page 0, the only page fetched without
+	// $select with ClientWithDefaults.DriftSample.
+	sampled int
+	seen    map[string]struct{}
+	added   map[string]map[string]struct{}
+	changed map[string]map[string]struct{}
+	unknown map[string]map[string]struct{}
+}
+
+// NewDriftDetector returns a detector for the Store schema of api.yaml.
+func NewDriftDetector() (*DriftDetector, error) {
+	fields, err := SchemaFields("Store")
+	if err != nil {
+		return nil, err
+	}
+
+	return &DriftDetector{
+		fields:  fields,
+		seen:    make(map[string]struct{}),
+		added:   make(map[string]map[string]struct{}),
+		changed: make(map[string]map[string]struct{}),
+		unknown: make(map[string]map[string]struct{}),
+	}, nil
+}
+
+// Page checks the records of a raw page body. Bodies that are not a store
+// page are skipped; failing them is up to the decoder.
+func (d *DriftDetector) Page(_ context.Context, page int, body []byte) {
+	var res struct {
+		Value []map[string]any `json:"value"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&res); err != nil {
+		logger.Debug("esb.DriftDetector.Page: skipping undecodable page", "error", err, "page", page)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if page == 0 {
+		d.sampled += len(res.Value)
+	}
+	for _, record := range res.Value {
+		for field, value := range record {
+			d.seen[field] = struct{}{}
+			if value == nil {
+				continue
+			}
+
+			got := jsonType(value)
+			fs, ok := d.fields[field]
+			switch {
+			case !ok:
+				add(d.added, field, got)
+			case !typeMatches(fs.Type, got):
+				add(d.changed, field, got)
+			case len(fs.Enum) > 0 && got == "string":
+				if s := value.(string); s != "" && !slices.Contains(fs.Enum, s) && len(d.unknown[field]) < maxEnumValues {
+					add(d.unknown, field, s)
+				}
+			}
+		}
+	}
+}
+
+// Drift returns the drift found so far. Missing fields are only reported
+// once records of page 0 were inspected: the other pages may be fetched
+// with $select, which leaves out fields ESB still sends, e.g. when page 0
+// failed in partial mode.
+func (d *DriftDetector) Drift() *Drift {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	drift := &Drift{}
+	for _, field := range slices.Sorted(maps.Keys(d.added)) {
+		drift.New = append(drift.New, FieldDrift{Field: field, Got: joinKeys(d.added[field])})
+	}
+	if d.sampled > 0 {
+		for _, field := range slices.Sorted(maps.Keys(d.fields)) {
+			if _, ok := d.seen[field]; !ok {
+				drift.Missing = append(drift.Missing, FieldDrift{Field: field, Expected: d.fields[field].Type})
+			}
+		}
+	}
+	for _, field := range slices.Sorted(maps.Keys(d.changed)) {
+		drift.TypeChanged = append(drift.TypeChanged, FieldDrift{Field: field, Expected: d.fields[field].Type, Got: joinKeys(d.changed[field])})
+	}
+	for _, field := range slices.Sorted(maps.Keys(d.unknown)) {
+		drift.UnknownEnum = append(drift.UnknownEnum, FieldDrift{Field: field, Expected: strings.Join(d.fields[field].Enum, ", "), Got: joinKeys(d.unknown[field])})
+	}
+
+	return drift
+}
+
+// jsonType names the JSON schema type of a value decoded with UseNumber.
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func typeMatches(expected, got string) bool {
+	return expected == "" || expected == got || expected == "number" && got == "integer"
+}
+
+func add(m map[string]map[string]struct{}, field, value string) {
+	if m[field] == nil {
+		m[field] = make(map[string]struct{})
+	}
+	m[field][value] = struct{}{}
+}
+
+func joinKeys(m map[string]struct{}) string {
+	return strings.Join(slices.Sorted(maps.Keys(m)), ", ")
+}
@@ -0,0 +1,105 @@
+package esb
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go-esb-store/internal/esb/esbtest"
+)
+
+func TestDriftSampleShowsNewFields(t *testing.T) {
+	fixtures := esbtest.Stores("RUS", 1, 250)
+	for _, f := range fixtures {
+		f["LoyaltyProgram"] = "Fix Price"
+	}
+
+	for _, pagination := range []Pagination{PaginationSkip, PaginationNextLink} {
+		t.Run(string(pagination), func(t *testing.T) {
+			srv := esbtest.NewServer(fixtures)
+			defer srv.Close()
+
+			c, err := NewESBClient(testConfig(t, map[string]string{
+				"ESB_BASE_URL":   srv.URL,
+				"ESB_API_KEY":    "key",
+				"ESB_PAGINATION": string(pagination),
+			}), []string{"NameAlias", "PrimaryAddress"})
+			if err != nil {
+				t.Fatalf("NewESBClient() error = %v", err)
+			}
+
+			drift, err := NewDriftDetector()
+			if err != nil {
+				t.Fatalf("NewDriftDetector() error = %v", err)
+			}
+			c.DriftSample = true
+			c.OnPageBody = drift.Page
+
+			stores, err := c.GetStores(context.Background())
+			if err != nil {
+				t.Fatalf("GetStores() error = %v", err)
+			}
+			if len(stores) != len(fixtures) {
+				t.Errorf("GetStores() = %d stores, want %d", len(stores), len(fixtures))
+			}
+
+			d := drift.Drift()
+			if !slices.Equal(d.New, []FieldDrift{{Field: "LoyaltyProgram", Got: "string"}}) {
+				t.Errorf("new fields = %v, want LoyaltyProgram", d.New)
+			}
+			for _, f := range d.Missing {
+				if _, ok := fixtures[0][f.Field]; ok {
+					t.Errorf("field %s left out by $select reported missing", f.Field)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectWithoutDriftSample(t *testing.T) {
+	fixtures := esbtest.Stores("RUS", 1, 10)
+	for _, f := range fixtures {
+		f["LoyaltyProgram"] = "Fix Price"
+	}
+	srv := esbtest.NewServer(fixtures)
+	defer srv.Close()
+
+	c, err := NewESBClient(testConfig(t, map[string]string{
+		"ESB_BASE_URL": srv.URL,
+		"ESB_API_KEY":  "key",
+	}), []string{"NameAlias"})
+	if err != nil {
+		t.Fatalf("NewESBClient() error = %v", err)
+	}
+	drift, err := NewDriftDetector()
+	if err != nil {
+		t.Fatalf("NewDriftDetector() error = %v", err)
+	}
+	c.OnPageBody = drift.Page
+
+	if _, err = c.GetStores(context.Background()); err != nil {
+		t.Fatalf("GetStores() error = %v", err)
+	}
+	if d := drift.Drift(); len(d.New) > 0 {
+		t.Errorf("new fields = %v, want none past $select", d.New)
+	}
+}
+
+func TestDriftMissingNeedsSamplePage(t *testing.T) {
+	drift, err := NewDriftDetector()
+	if err != nil {
+		t.Fatalf("NewDriftDetector() error = %v", err)
+	}
+
+	// Pages past the sample are fetched with $select.
+	drift.Page(context.Background(), 1, []byte(`{"value":[{"NameAlias":"Магазин 1"}]}`))
+	if d := drift.Drift(); len(d.Missing) > 0 {
+		t.Errorf("missing fields = %v without the sample page, want none", d.Missing)
+	}
+
+	drift.Page(context.Background(), 0, []byte(`{"value":[{"NameAlias":"Магазин 2"}]}`))
+	d := drift.Drift()
+	if len(d.Missing) == 0 || slices.ContainsFunc(d.Missing, func(f FieldDrift) bool { return f.Field == "NameAlias" }) {
+		t.Errorf("missing fields = %v after the sample page, want all but NameAlias", d.Missing)
+	}
+}
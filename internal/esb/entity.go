@@ -0,0 +1,199 @@
+package esb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-esb-store/pkg/logger"
+)
+
+// Entity describes an OData entity set other than RetailStoresESB. It is
+// fetched with the paging of ClientWithDefaults, but its records are
+// decoded generically: they are not checked against api.yaml and do not
+// reach OnPageBody, which only see store pages.
+type Entity struct {
+	// Set is the entity set path, e.g. "LegalEntitiesESB".
+	Set string
+	// Filter is the $filter of the entity set, if any.
+	Filter string
+	// OrderBy keeps $skip pages stable, usually the key fields.
+	OrderBy string
+	// Select lists the fields to fetch; all of them if empty.
+	Select []string
+	// Key lists the key fields, which identify a record across pages.
+	// Records are identified by their whole content if empty.
+	Key []string
+	// AllowEmpty makes an empty entity set a valid outcome instead of
+	// ErrNoData, whatever the AllowEmpty of the client.
+	AllowEmpty bool
+}
+
+// Record is an entity record decoded with UseNumber: values are string,
+// json.Number, bool, nil, []any or map[string]any.
+type Record map[string]any
+
+// entityResponse is a page of an entity set.
+type entityResponse struct {
+	OdataCount    *int     `json:"@odata.count,omitempty"`
+	OdataNextLink *string  `json:"@odata.nextLink,omitempty"`
+	Value         []Record `json:"value,omitempty"`
+}
+
+// EntityPages yields the records of an entity set page by page, just like
+// StorePages does for stores, including partial mode. An empty entity set
+// is ErrNoData unless the client or the entity allows it.
+func (c *ClientWithDefaults) EntityPages(ctx context.Context, e Entity) iter.Seq2[[]Record, error] {
+	return c.entityPager(e).pages(ctx)
+}
+
+func (c *ClientWithDefaults) entityPager(e Entity) *pager[Record] {
+	client := c
+	if e.AllowEmpty {
+		d := *c
+		d.AllowEmpty = true
+		client = &d
+	}
+
+	return &pager[Record]{
+		ClientWithDefaults: client,
+		set:                e.Set,
+		count: func(ctx context.Context) (int, error) {
+			return c.getEntityCount(ctx, e)
+		},
+		page: func(ctx context.Context, page int) ([]Record, error) {
+			res, err := c.getEntityPage(ctx, e, page, entityQuery(e, url.Values{
+				"skip": {strconv.Itoa(page * c.PageSize)},
+				"top":  {strconv.Itoa(c.PageSize)},
+			}))
+			if err != nil {
+				return nil, err
+			}
+			return res.Value, nil
+		},
+		link: func(ctx context.Context, page int, link string) (*linkPage[Record], error) {
+			if link == "" {
+				link = entityQuery(e, url.Values{"count": {"true"}})
+			}
+			res, err := c.getEntityPage(ctx, e, page, link, c.preferPageSize)
+			if err != nil {
+				return nil, err
+			}
+
+			out := &linkPage[Record]{values: res.Value, count: res.OdataCount}
+			if res.OdataNextLink != nil {
+				out.next = *res.OdataNextLink
+			}
+			return out, nil
+		},
+		key: func(r Record) string {
+			return recordKey(r, e.Key)
+		},
+	}
+}
+
+// recordKey joins the values of the key fields of a record, or returns ""
+// if there are no key fields or one is missing.
+func recordKey(r Record, key []string) string {
+	parts := make([]string, 0, len(key))
+	for _, k := range key {
+		v, ok := r[k]
+		if !ok || v == nil {
+			return ""
+		}
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(parts, "/")
+}
+
+func (c *ClientWithDefaults) getEntityCount(ctx context.Context, e Entity) (int, error) {
+	q := url.Values{}
+	if e.Filter != "" {
+		q.Set("filter", e.Filter)
+	}
+	ref := "./" + url.PathEscape(e.Set) + "/$count"
+	if len(q) > 0 {
+		ref += "?" + q.Encode()
+	}
+
+	rsp, err := c.send(ctx, ref)
+	if err != nil {
+		logger.Error("esb.getEntityCount: error getting count", "error", err, "set", e.Set)
+		return -1, err
+	}
+	body, err := io.ReadAll(rsp.Body)
+	_ = rsp.Body.Close()
+	if err != nil {
+		return -1, err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		logger.Error("esb.getEntityCount: non-200 response", "status", rsp.Status, "set", e.Set)
+		return -1, fmt.Errorf("%w: %s", ErrUnexpectedStatus, rsp.Status)
+	}
+
+	count, err := parseCount(body)
+	if err != nil {
+		logger.Error("esb.getEntityCount: invalid count", "error", err, "set", e.Set)
+		return -1, err
+	}
+
+	logger.Info("esb.getEntityCount: got count", "set", e.Set, "count", count, "pages", c.pagesCount(count), "limit", c.PageSize, "endpoint", servedBy(rsp))
+
+	return count, nil
+}
+
+func (c *ClientWithDefaults) getEntityPage(ctx context.Context, e Entity, page int, ref string, editors ...RequestEditorFn) (*entityResponse, error) {
+	logger.Info("esb.getEntityPage: getting records", "set", e.Set, "page", page, "limit", c.PageSize, "time", time.Now().String())
+
+	rsp, err := c.send(ctx, ref, editors...)
+	if err != nil {
+		logger.Error("esb.getEntityPage: error getting page", "error", err, "set", e.Set, "page", page)
+		return nil, err
+	}
+	body, err := io.ReadAll(rsp.Body)
+	_ = rsp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("esb.getEntityPage: page served", "set", e.Set, "page", page, "status", rsp.StatusCode, "endpoint", servedBy(rsp))
+
+	if rsp.StatusCode != http.StatusOK {
+		logger.Error("esb.getEntityPage: non-200 response", "status", rsp.Status, "set", e.Set, "page", page)
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedStatus, rsp.Status)
+	}
+
+	var res entityResponse
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err = dec.Decode(&res); err != nil {
+		return nil, err
+	}
+
+	logger.Info("esb.getEntityPage: got records", "set", e.Set, "count", len(res.Value), "page", page)
+	return &res, nil
+}
+
+// entityQuery returns the relative reference of an entity set page, with
+// the query parameters named as the generated client names them.
+func entityQuery(e Entity, q url.Values) string {
+	if e.Filter != "" {
+		q.Set("filter", e.Filter)
+	}
+	if e.OrderBy != "" {
+		q.Set("orderby", e.OrderBy)
+	}
+	if sel := SelectFields(e.Select); sel != "" {
+		q.Set("select", sel)
+	}
+
+	return "./" + url.PathEscape(e.Set) + "?" + q.Encode()
+}
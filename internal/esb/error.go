@@ -2,8 +2,31 @@ package esb
 
 import "errors"
 
-var ErrNoStoresData = errors.New("got no stores data")
+var ErrNoData = errors.New("got no data")
 var ErrNoPageToFetch = errors.New("got no page to fetch")
+var ErrCountMismatch = errors.New("records count mismatch")
+var ErrNoEndpoints = errors.New("no ESB base url")
+var ErrUnsupportedPagination = errors.New("unsupported pagination mode")
+var ErrNextLinkLoop = errors.New("next link points to an already fetched page")
+
+// Deprecated: ErrNoStoresData and ErrInvalidStoresCount are the former
+// names of ErrNoData and ErrInvalidCount.
+var (
+	ErrNoStoresData       = ErrNoData
+	ErrInvalidStoresCount = ErrInvalidCount
+)
 
 var ErrUnexpectedStatus = errors.New("unexpected http status")
-var ErrInvalidStoresCount = errors.New("invalid stores count")
+var ErrInvalidCount = errors.New("invalid records count")
+var ErrRetriesExhausted = errors.New("retries exhausted")
+var ErrTransport = errors.New("invalid transport config")
+
+var ErrUnsupportedAuth = errors.New("unsupported auth mode")
+var ErrMissingCredentials = errors.New("missing ESB credentials")
+var ErrTokenRequest = errors.New("oauth2 token request failed")
+
+var ErrSpec = errors.New("invalid api spec")
+var ErrInvalidResponse = errors.New("response does not match api spec")
+
+var ErrCassette = errors.New("cassette error")
+var ErrCassetteMiss = errors.New("request not found in cassette")
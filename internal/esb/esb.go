@@ -1,161 +1,315 @@
 package esb
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"go-esb-store/internal/utils"
+	"io"
+	"iter"
 	"math"
 	"net/http"
 	"strconv"
-	"sync"
 	"time"
 
 	"go-esb-store/internal/config"
 	"go-esb-store/pkg/logger"
 )
 
+const (
+	defaultMaxConcurrency = 4
+	storesEntitySet       = "RetailStoresESB"
+	storesOrderBy         = "StoreFactsNumber"
+)
+
 type ClientWithDefaults struct {
 	*ClientWithResponses
-	PageSize int
+	PageSize        int
+	MaxConcurrency  int
+	Filter          string
+	Select          string
+	RefetchAttempts int
+	Pagination      Pagination
+	// AllowEmpty makes an empty result a valid outcome instead of
+	// ErrNoData, e.g. for delta syncs with nothing changed.
+	AllowEmpty bool
+	// Partial yields a *PageError for a failed page instead of failing the
+	// whole fetch.
+	Partial bool
+	// DriftSample fetches the first store page without $select, so that
+	// OnPageBody sees every field ESB sends and a schema drift detector
+	// notices new ones. Next links follow the first page, so with
+	// PaginationNextLink the whole run goes without $select.
+	DriftSample bool
+	// OnPageBody, if set, receives the raw body of every store page
+	// response before it is decoded. It may be called concurrently.
+	OnPageBody func(ctx context.Context, page int, body []byte)
+	// Validator, if set, checks every response against api.yaml before it
+	// is decoded.
+	Validator *Validator
 }
 
-func NewESBClient(cfg *config.ESB) (*ClientWithDefaults, error) {
+// NewESBClient returns a client of the ESB gateways in cfg. Store pages
+// $select fields, the ESB fields the caller maps, along with the ones the
+// client needs and ESB_SELECT_EXTRA; every field is fetched if fields is
+// empty.
+func NewESBClient(cfg *config.ESB, fields []string) (*ClientWithDefaults, error) {
+	pagination := Pagination(cfg.Pagination)
+	if pagination != PaginationSkip && pagination != PaginationNextLink {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedPagination, cfg.Pagination)
+	}
+
 	raw, err := newClient(cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	var validator *Validator
+	if cfg.Validate {
+		if validator, err = NewValidator(); err != nil {
+			return nil, err
+		}
+	}
+
+	var sel string
+	if len(fields) > 0 {
+		sel = SelectFields(fields, clientFields, cfg.SelectExtra)
+	}
+
 	return &ClientWithDefaults{
 		ClientWithResponses: raw,
 		PageSize:            cfg.LimitPageSize,
+		MaxConcurrency:      cfg.MaxConcurrency,
+		Filter:              BuildFilter(cfg.Countries, cfg.Filter),
+		Select:              sel,
+		RefetchAttempts:     cfg.RefetchAttempts,
+		Pagination:          pagination,
+		Partial:             cfg.Partial,
+		Validator:           validator,
 	}, nil
 }
 
 func newClient(cfg *config.ESB) (*ClientWithResponses, error) {
-	return NewClientWithResponses(
-		cfg.BaseURL.String(),
-		WithHTTPClient(&http.Client{Timeout: cfg.Timeout * time.Second}),
-		WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.APIKey))
-			return nil
-		}),
-	)
-}
-
-func (c *ClientWithDefaults) GetStores(ctx context.Context) ([]Store, error) {
-	logger.Debug("esb.GetStores: start getting stores pages count")
-
-	pages, err := c.getStoresPagesCount(ctx)
+	transport, err := newTransport(cfg)
 	if err != nil {
-		logger.Error("esb.GetStores: error getting stores", "error", err)
 		return nil, err
 	}
-	if pages < 1 {
-		logger.Error(fmt.Sprintf("esb.GetStores: %s", ErrNoPageToFetch))
-		return nil, ErrNoPageToFetch
+
+	var doer HttpRequestDoer = &http.Client{Timeout: cfg.Timeout, Transport: transport}
+
+	mode := CassetteMode(cfg.CassetteMode)
+	switch mode {
+	case CassetteOff:
+	case CassetteRecord:
+		rec, err := newRecordDoer(doer, cfg.CassetteDir)
+		if err != nil {
+			return nil, err
+		}
+		doer = rec
+		logger.Info("esb.newClient: recording ESB responses", "dir", cfg.CassetteDir)
+	case CassetteReplay:
+		rep, err := newReplayDoer(cfg.CassetteDir)
+		if err != nil {
+			return nil, err
+		}
+		doer = rep
+		logger.Info("esb.newClient: replaying ESB responses", "dir", cfg.CassetteDir)
+	default:
+		return nil, fmt.Errorf("%w: unsupported mode %q", ErrCassette, cfg.CassetteMode)
 	}
-	logger.Debug("esb.GetStores: pages ", "pages", pages)
 
-	var (
-		wg     sync.WaitGroup
-		mu     sync.Mutex
-		stores = make([]Store, 0, pages*c.PageSize)
-		errCh  = make(chan error, pages)
+	if len(cfg.BaseURLs) == 0 {
+		return nil, ErrNoEndpoints
+	}
+
+	// Below failover, so that every gateway is limited on its own.
+	if cfg.RateLimit > 0 && mode != CassetteReplay {
+		doer = newRateLimitDoer(doer, cfg.RateLimit, cfg.RateBurst)
+	}
+
+	if len(cfg.BaseURLs) > 1 && mode != CassetteReplay {
+		doer = newFailoverDoer(doer, cfg.BaseURLs)
+	}
+
+	doer = newRetryDoer(
+		doer,
+		RetryPolicy{
+			MaxAttempts: cfg.RetryAttempts,
+			BaseDelay:   cfg.RetryDelay,
+			MaxDelay:    cfg.RetryMaxDelay,
+		},
 	)
 
-	for i := 0; i < pages; i++ {
-		wg.Add(1)
-		page := i
-		go func() {
-			logger.Debug("esb.GetStores: start goroutine with getting stores page", "page", page)
-			defer wg.Done()
-
-			storesPage, er := c.getStoresPageData(ctx, page)
-			if er != nil {
-				errCh <- er
-				return
-			}
-			if len(storesPage) == 0 {
-				return
-			}
-
-			mu.Lock()
-			stores = append(stores, storesPage...)
-			mu.Unlock()
-			logger.Debug("esb.GetStores: goroutine finished successfully", "page", page)
-		}()
-	}
-
-	wg.Wait()
-	close(errCh)
-
-	var errs error
-	for e := range errCh {
-		if e != nil {
-			logger.Error("esb.GetStores: error getting stores", "error", e)
-			errs = errors.Join(errs, e)
+	// Recorded responses are served without credentials.
+	if mode != CassetteReplay {
+		auth, err := newAuthenticator(cfg, doer)
+		if err != nil {
+			return nil, err
 		}
-	}
-	if errs != nil {
-		return nil, errs
+		doer = newAuthDoer(doer, auth)
 	}
 
-	if len(stores) == 0 {
-		logger.Error(fmt.Sprintf("esb.GetStores: %s", ErrNoStoresData))
-		return nil, ErrNoStoresData
+	return NewClientWithResponses(
+		cfg.BaseURLs[0].String(),
+		WithHTTPClient(doer),
+	)
+}
+
+// GetStores fetches every store page and returns them as a single slice.
+// Prefer StorePages when the caller can process pages one by one. In partial
+// mode the stores of the successful pages are returned with a *PartialError
+// listing the failed ones.
+func (c *ClientWithDefaults) GetStores(ctx context.Context) ([]Store, error) {
+	var (
+		stores []Store
+		failed []*PageError
+	)
+	for page, err := range c.StorePages(ctx) {
+		var pageErr *PageError
+		if errors.As(err, &pageErr) {
+			failed = append(failed, pageErr)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, page...)
 	}
 
-	logger.Info("esb.GetStores: got stores", "count", len(stores), "pages", pages, "limit", c.PageSize)
+	if len(failed) > 0 {
+		return stores, &PartialError{Failed: failed}
+	}
 	return stores, nil
 }
 
-func (c *ClientWithDefaults) getStoresPagesCount(ctx context.Context) (int, error) {
-	filter := GetStoresCountParamsFilterPrimaryCountryRegionIdEqRUS
+// StorePages yields store pages as soon as they are fetched. Breaking out of
+// the loop cancels the outstanding requests. A fetch error is yielded once
+// and ends the sequence. Records already yielded are dropped from later pages.
+//
+// In partial mode a failed page is yielded as a *PageError and the other
+// pages are still fetched; $count is not verified then, as the result is
+// known to be incomplete. With nextlink paging the pages after a failed one
+// cannot be reached, so the sequence ends there.
+func (c *ClientWithDefaults) StorePages(ctx context.Context) iter.Seq2[[]Store, error] {
+	return c.storePager().pages(ctx)
+}
+
+func (c *ClientWithDefaults) storePager() *pager[Store] {
+	return &pager[Store]{
+		ClientWithDefaults: c,
+		set:                storesEntitySet,
+		count:              c.getStoresCount,
+		page:               c.getStoresPageData,
+		link:               c.getStoresLinkPage,
+		key:                storeKey,
+	}
+}
+
+// storeKey identifies a store by country and store number, as numbers are
+// only unique within a country.
+func storeKey(s Store) string {
+	if s.StoreFactsNumber == nil {
+		return ""
+	}
+	country := ""
+	if s.PrimaryCountryRegionId != nil {
+		country = *s.PrimaryCountryRegionId
+	}
+	return country + "/" + *s.StoreFactsNumber
+}
 
+func (c *ClientWithDefaults) maxConcurrency() int {
+	if c.MaxConcurrency < 1 {
+		return defaultMaxConcurrency
+	}
+	return c.MaxConcurrency
+}
+
+func (c *ClientWithDefaults) pagesCount(count int) int {
+	return int(math.Ceil(float64(count) / float64(c.PageSize)))
+}
+
+func (c *ClientWithDefaults) getStoresCount(ctx context.Context) (int, error) {
 	res, err := c.GetStoresCountWithResponse(
 		ctx,
 		&GetStoresCountParams{
-			Filter: &filter,
+			Filter: c.filter(),
 		},
 	)
 
 	if err != nil {
-		logger.Error("esb.getStoresPagesCount: error getting store count", "error", err)
+		logger.Error("esb.getStoresCount: error getting store count", "error", err)
+		return -1, err
+	}
+
+	if err = c.Validator.Validate(operationGetStoresCount, -1, res.HTTPResponse, res.Body); err != nil {
+		logger.Error("esb.getStoresCount: invalid response", "error", err)
 		return -1, err
 	}
 
 	if res.StatusCode() != http.StatusOK {
-		logger.Error("esb.getStoresPagesCount: non-200 response", "status", res.Status())
+		logger.Error("esb.getStoresCount: non-200 response", "status", res.Status())
 		return -1, fmt.Errorf("%w: %s", ErrUnexpectedStatus, res.Status())
 	}
 
-	cleanedBody := utils.CleanString(string(res.Body))
+	count, err := parseCount(res.Body)
+	if err != nil {
+		logger.Error("esb.getStoresCount: invalid count", "error", err)
+		return -1, err
+	}
+
+	logger.Info("esb.getStoresCount: got store count", "count", count, "pages", c.pagesCount(count), "limit", c.PageSize, "endpoint", servedBy(res.HTTPResponse))
+
+	return count, nil
+}
+
+// parseCount parses a plain text $count result, which ESB prefixes with a
+// byte order mark.
+func parseCount(body []byte) (int, error) {
+	cleanedBody := utils.CleanString(string(body))
 	count, err := strconv.Atoi(cleanedBody)
 	if err != nil {
-		logger.Error("esb.getStoresPagesCount: atoi failed", "error", err, "body", cleanedBody)
-		return -1, fmt.Errorf("%w: %q", ErrInvalidStoresCount, cleanedBody)
+		return -1, fmt.Errorf("%w: %q", ErrInvalidCount, cleanedBody)
 	}
+	return count, nil
+}
 
-	pages := int(math.Ceil(float64(count) / float64(c.PageSize)))
-	logger.Info("esb.getStoresPagesCount: got store count", "count", count, "pages", pages, "limit", c.PageSize)
+func (c *ClientWithDefaults) filter() *string {
+	if c.Filter == "" {
+		return nil
+	}
+	return &c.Filter
+}
 
-	return pages, nil
+// selectFields returns the $select of a store page, none for the drift
+// sample.
+func (c *ClientWithDefaults) selectFields(page int) *string {
+	if c.Select == "" || c.DriftSample && page == 0 {
+		return nil
+	}
+	return &c.Select
 }
 
 func (c *ClientWithDefaults) getStoresPageData(ctx context.Context, page int) ([]Store, error) {
-	filter := GetStoresParamsFilterPrimaryCountryRegionIdEqRUS
 	skip := page * c.PageSize
+	orderBy := storesOrderBy
 
 	logger.Info("esb.getStoresPageData: getting stores", "page", page, "limit", c.PageSize, "skip", skip, "time", time.Now().String())
-	res, err := c.GetStoresWithResponse(
+	rsp, err := c.ClientInterface.GetStores(
 		ctx,
 		&GetStoresParams{
-			Filter: &filter,
-			Skip:   &skip,
-			Top:    &c.PageSize,
+			Filter:  c.filter(),
+			Orderby: &orderBy,
+			Select:  c.selectFields(page),
+			Skip:    &skip,
+			Top:     &c.PageSize,
 		},
 	)
+	var res *GetStoresResponse
+	if err == nil {
+		res, err = c.parseStoresPage(ctx, page, rsp)
+	}
 
 	if err != nil {
 		logger.Error("esb.getStoresPageData: error getting stores page", "error", err, "page", page)
@@ -175,3 +329,27 @@ func (c *ClientWithDefaults) getStoresPageData(ctx context.Context, page int) ([
 	logger.Info("esb.getStoresPageData: got stores", "count", len(stores), "page", page, "limit", c.PageSize, "skip", skip, "time", time.Now().String())
 	return stores, nil
 }
+
+// parseStoresPage decodes a store page response. The raw body goes to
+// OnPageBody and the Validator first, so pages that fail validation or
+// decoding are kept as well.
+func (c *ClientWithDefaults) parseStoresPage(ctx context.Context, page int, rsp *http.Response) (*GetStoresResponse, error) {
+	logger.Info("esb.parseStoresPage: page served", "page", page, "status", rsp.StatusCode, "endpoint", servedBy(rsp))
+
+	if c.OnPageBody != nil || c.Validator != nil {
+		body, err := io.ReadAll(rsp.Body)
+		_ = rsp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if c.OnPageBody != nil {
+			c.OnPageBody(ctx, page, body)
+		}
+		if err = c.Validator.Validate(operationGetStores, page, rsp, body); err != nil {
+			return nil, err
+		}
+		rsp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return ParseGetStoresResponse(rsp)
+}
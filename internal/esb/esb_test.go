@@ -0,0 +1,99 @@
+package esb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"go-esb-store/internal/esb/esbtest"
+)
+
+func TestGetStores(t *testing.T) {
+	fixtures := append(esbtest.Stores("RUS", 1, 250), esbtest.Stores("KAZ", 1, 30)...)
+	fixtures = append(fixtures, esbtest.Stores("BLR", 1, 10)...)
+
+	for _, pagination := range []Pagination{PaginationSkip, PaginationNextLink} {
+		t.Run(string(pagination), func(t *testing.T) {
+			srv := esbtest.NewServer(fixtures)
+			defer srv.Close()
+
+			c, err := NewESBClient(testConfig(t, map[string]string{
+				"ESB_BASE_URL":   srv.URL,
+				"ESB_API_KEY":    "key",
+				"ESB_COUNTRIES":  "RUS,KAZ",
+				"ESB_PAGINATION": string(pagination),
+			}), nil)
+			if err != nil {
+				t.Fatalf("NewESBClient() error = %v", err)
+			}
+
+			stores, err := c.GetStores(context.Background())
+			if err != nil {
+				t.Fatalf("GetStores() error = %v", err)
+			}
+			if len(stores) != 280 {
+				t.Fatalf("GetStores() = %d stores, want 280", len(stores))
+			}
+
+			seen := make(map[string]struct{}, len(stores))
+			for _, s := range stores {
+				key := storeKey(s)
+				if _, ok := seen[key]; ok {
+					t.Errorf("store %s returned twice", key)
+				}
+				seen[key] = struct{}{}
+				if *s.PrimaryCountryRegionId == "BLR" {
+					t.Errorf("store %s of a country not synced", key)
+				}
+			}
+		})
+	}
+}
+
+func TestGetStoresPartial(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 250))
+	defer srv.Close()
+	srv.Inject(esbtest.Fault{Match: esbtest.OnPage(100), Status: http.StatusBadGateway})
+
+	c, err := NewESBClient(testConfig(t, map[string]string{
+		"ESB_BASE_URL":       srv.URL,
+		"ESB_API_KEY":        "key",
+		"ESB_PARTIAL":        "true",
+		"ESB_RETRY_ATTEMPTS": "1",
+	}), nil)
+	if err != nil {
+		t.Fatalf("NewESBClient() error = %v", err)
+	}
+
+	stores, err := c.GetStores(context.Background())
+	var partialErr *PartialError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("GetStores() error = %v, want a *PartialError", err)
+	}
+	if pages := partialErr.Pages(); !slices.Equal(pages, []int{1}) {
+		t.Errorf("failed pages = %v, want [1]", pages)
+	}
+	if len(stores) != 150 {
+		t.Errorf("GetStores() = %d stores, want 150", len(stores))
+	}
+}
+
+func TestGetStoresUnauthorized(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 10))
+	defer srv.Close()
+	srv.Authorize = func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer key" }
+
+	c, err := NewESBClient(testConfig(t, map[string]string{
+		"ESB_BASE_URL": srv.URL,
+		"ESB_API_KEY":  "wrong",
+	}), nil)
+	if err != nil {
+		t.Fatalf("NewESBClient() error = %v", err)
+	}
+
+	if _, err = c.GetStores(context.Background()); !errors.Is(err, ErrUnexpectedStatus) {
+		t.Errorf("GetStores() error = %v, want %v", err, ErrUnexpectedStatus)
+	}
+}
@@ -0,0 +1,64 @@
+package esbtest
+
+import (
+	"fmt"
+	"strconv"
+)
+
+var (
+	fixtureStatuses = []string{"Open", "Open", "Open", "Closed", "New", "PreOpening", "Refranchised", "Dead"}
+	fixtureBrands   = []string{"FIX", "FIXP", "FIXH"}
+	fixtureFormats  = []string{"STD", "MINI", "MALL", "STREET"}
+	fixtureCities   = map[string][]string{
+		"RUS": {"г. Москва", "г. Санкт-Петербург", "г. Казань", "г. Новосибирск"},
+		"KAZ": {"г. Алматы", "г. Астана"},
+		"BLR": {"г. Минск", "г. Гомель"},
+	}
+)
+
+// Stores generates n store records of country with numbers starting at
+// first. Records are deterministic, so the same call always returns the
+// same fixture set.
+func Stores(country string, first, n int) []map[string]any {
+	cities := fixtureCities[country]
+	if len(cities) == 0 {
+		cities = []string{"г. Город"}
+	}
+
+	stores := make([]map[string]any, 0, n)
+	for i := 0; i < n; i++ {
+		number := first + i
+		city := cities[i%len(cities)]
+
+		st := map[string]any{
+			"StoreFactsNumber":       strconv.Itoa(number),
+			"NameAlias":              fmt.Sprintf("Магазин %d", number),
+			"PrimaryAddress":         fmt.Sprintf("%s, ул. Ленина, д. %d", city, i%120+1),
+			"PrimaryCountryRegionId": country,
+			"BrandId":                fixtureBrands[i%len(fixtureBrands)],
+			"StoreFormatId":          fixtureFormats[i%len(fixtureFormats)],
+			"Status":                 fixtureStatuses[i%len(fixtureStatuses)],
+			"TemporaryClosed":        i%17 == 0,
+			"OpeningDate":            fmt.Sprintf("20%02d-%02d-01T00:00:00Z", 10+i%14, i%12+1),
+			"Latitude":               55 + float64(i%100)/100,
+			"Longitude":              37 + float64(i%100)/100,
+			"AddressCity":            city,
+			"PrimaryPhone":           fmt.Sprintf("+7 495 %03d-%02d-%02d", number%1000, i%100, (i*7)%100),
+			"StoreArea":              float64(80 + i%200),
+			"ModifiedDateTime":       fmt.Sprintf("2024-%02d-%02dT%02d:00:00Z", i%12+1, i%28+1, i%24),
+		}
+		if i%17 == 0 {
+			st["TemporaryClosedReason"] = "Ремонт"
+		}
+		if i%3 == 0 {
+			st["FacilityShoppingCenterName"] = fmt.Sprintf("ТЦ «Радуга-%d»", i%7)
+		}
+		if i%5 == 0 {
+			st["FranchiseePartnerName"] = fmt.Sprintf("ООО «Партнёр %d»", i%11)
+		}
+
+		stores = append(stores, st)
+	}
+
+	return stores
+}
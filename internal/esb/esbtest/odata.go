@@ -0,0 +1,336 @@
+package esbtest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// predicate reports whether a record matches a parsed $filter.
+type predicate func(record map[string]any) bool
+
+// parseFilter parses the subset of OData $filter the ESB client sends:
+// comparisons (eq, ne, gt, ge, lt, le) of a field with a literal, combined
+// with and, or, not and parentheses. An empty filter matches everything.
+func parseFilter(s string) (predicate, error) {
+	if strings.TrimSpace(s) == "" {
+		return func(map[string]any) bool { return true }, nil
+	}
+
+	toks, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	pred, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q at token %d", p.toks[p.pos].text, p.pos)
+	}
+
+	return pred, nil
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokString
+	tokOpen
+	tokClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(s string) ([]token, error) {
+	var toks []token
+
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, token{kind: tokOpen, text: "("})
+			i++
+		case r == ')':
+			toks = append(toks, token{kind: tokClose, text: ")"})
+			i++
+		case r == '\'':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(rs) {
+					return nil, fmt.Errorf("unterminated string in %q", s)
+				}
+				if rs[i] == '\'' {
+					if i+1 < len(rs) && rs[i+1] == '\'' {
+						b.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteRune(rs[i])
+				i++
+			}
+			toks = append(toks, token{kind: tokString, text: b.String()})
+		default:
+			start := i
+			for i < len(rs) && !unicode.IsSpace(rs[i]) && rs[i] != '(' && rs[i] != ')' && rs[i] != '\'' {
+				i++
+			}
+			toks = append(toks, token{kind: tokWord, text: string(rs[start:i])})
+		}
+	}
+
+	return toks, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peekWord(w string) bool {
+	return p.pos < len(p.toks) && p.toks[p.pos].kind == tokWord && strings.EqualFold(p.toks[p.pos].text, w)
+}
+
+func (p *parser) or() (predicate, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("or") {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r map[string]any) bool { return l(r) || right(r) }
+	}
+	return left, nil
+}
+
+func (p *parser) and() (predicate, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("and") {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r map[string]any) bool { return l(r) && right(r) }
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (predicate, error) {
+	if p.peekWord("not") {
+		p.pos++
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(r map[string]any) bool { return !inner(r) }, nil
+	}
+
+	if p.pos < len(p.toks) && p.toks[p.pos].kind == tokOpen {
+		p.pos++
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.toks) || p.toks[p.pos].kind != tokClose {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return inner, nil
+	}
+
+	return p.comparison()
+}
+
+func (p *parser) comparison() (predicate, error) {
+	if p.pos+3 > len(p.toks) {
+		return nil, fmt.Errorf("incomplete comparison")
+	}
+	field, op, lit := p.toks[p.pos], p.toks[p.pos+1], p.toks[p.pos+2]
+	if field.kind != tokWord || op.kind != tokWord {
+		return nil, fmt.Errorf("invalid comparison near %q", field.text)
+	}
+	p.pos += 3
+
+	value, err := literal(lit)
+	if err != nil {
+		return nil, err
+	}
+
+	var test func(c int) bool
+	switch strings.ToLower(op.text) {
+	case "eq":
+		test = func(c int) bool { return c == 0 }
+	case "ne":
+		test = func(c int) bool { return c != 0 }
+	case "gt":
+		test = func(c int) bool { return c > 0 }
+	case "ge":
+		test = func(c int) bool { return c >= 0 }
+	case "lt":
+		test = func(c int) bool { return c < 0 }
+	case "le":
+		test = func(c int) bool { return c <= 0 }
+	default:
+		return nil, fmt.Errorf("unsupported operator %q", op.text)
+	}
+
+	name := field.text
+	return func(r map[string]any) bool {
+		c, ok := compare(r[name], value)
+		if !ok {
+			return strings.EqualFold(op.text, "ne")
+		}
+		return test(c)
+	}, nil
+}
+
+// literal converts a filter literal to the type JSON decoding produces.
+// Unquoted words that are not numbers, booleans or null, such as
+// 2024-01-02T03:04:05Z, are kept as strings.
+func literal(t token) (any, error) {
+	switch t.kind {
+	case tokString:
+		return t.text, nil
+	case tokWord:
+		switch strings.ToLower(t.text) {
+		case "null":
+			return nil, nil
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		if f, err := strconv.ParseFloat(t.text, 64); err == nil {
+			return f, nil
+		}
+		return t.text, nil
+	default:
+		return nil, fmt.Errorf("invalid literal %q", t.text)
+	}
+}
+
+// compare orders two JSON values of the same type. The second result is
+// false if the values are not comparable.
+func compare(a, b any) (int, bool) {
+	switch av := a.(type) {
+	case nil:
+		if b == nil {
+			return 0, true
+		}
+		return 0, false
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(av, bv), true
+	case float64:
+		bv, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case av < bv:
+			return -1, true
+		case av > bv:
+			return 1, true
+		default:
+			return 0, true
+		}
+	case bool:
+		bv, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case av == bv:
+			return 0, true
+		case !av:
+			return -1, true
+		default:
+			return 1, true
+		}
+	default:
+		return 0, false
+	}
+}
+
+// sortRecords applies an OData $orderby such as "StoreFactsNumber desc,
+// NameAlias". Nulls sort first, as in OData.
+func sortRecords(records []map[string]any, orderBy string) error {
+	type key struct {
+		field string
+		desc  bool
+	}
+
+	var keys []key
+	for _, part := range strings.Split(orderBy, ",") {
+		fields := strings.Fields(part)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			keys = append(keys, key{field: fields[0]})
+		case 2:
+			dir := strings.ToLower(fields[1])
+			if dir != "asc" && dir != "desc" {
+				return fmt.Errorf("invalid order direction %q", fields[1])
+			}
+			keys = append(keys, key{field: fields[0], desc: dir == "desc"})
+		default:
+			return fmt.Errorf("invalid order clause %q", part)
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		for _, k := range keys {
+			a, b := records[i][k.field], records[j][k.field]
+			var c int
+			switch {
+			case a == nil && b == nil:
+				c = 0
+			case a == nil:
+				c = -1
+			case b == nil:
+				c = 1
+			default:
+				c, _ = compare(a, b)
+			}
+			if c == 0 {
+				continue
+			}
+			if k.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	return nil
+}
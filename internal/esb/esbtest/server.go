@@ -0,0 +1,382 @@
+package esbtest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	storesPath = "/RetailStoresESB"
+	countPath  = "/RetailStoresESB/$count"
+)
+
+// Fault alters the responses of matching requests.
+type Fault struct {
+	// Match selects the affected requests; nil matches every request.
+	Match func(r *http.Request) bool
+	// Times limits how many requests are affected; zero means all of them.
+	Times int
+
+	// Latency delays the response.
+	Latency time.Duration
+	// Status replies with this code (e.g. 429, 502, 503) and no data.
+	Status int
+	// RetryAfter is sent as the Retry-After header together with Status.
+	RetryAfter string
+	// MalformedJSON replies 200 with a truncated JSON body.
+	MalformedJSON bool
+	// Body replies 200 with this body as ContentType, e.g. the HTML error
+	// page of a gateway.
+	Body        string
+	ContentType string
+	// CountDelta is added to the $count result.
+	CountDelta int
+}
+
+// OnCount matches $count requests.
+func OnCount() func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		return r.URL.Path == countPath
+	}
+}
+
+// OnPage matches store page requests with the given skip.
+func OnPage(skip int) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		if r.URL.Path != storesPath {
+			return false
+		}
+		v, _ := strconv.Atoi(queryParam(r.URL.Query(), "skip"))
+		return v == skip
+	}
+}
+
+// Server is an in-process ESB OData service over an in-memory fixture set.
+// It serves /RetailStoresESB with $filter, $orderby, $select, $skip, $top
+// and $count=true, server-driven paging via Prefer: odata.maxpagesize, and
+// /RetailStoresESB/$count, and other entity sets the same way, see
+// SetEntitySet. Query options are accepted with or without the $ prefix,
+// as the generated client omits it.
+type Server struct {
+	*httptest.Server
+
+	// Authorize rejects requests with 401 when it returns false;
+	// nil accepts every request. See TokenServer.Authorized.
+	Authorize func(r *http.Request) bool
+
+	mu       sync.Mutex
+	stores   []map[string]any
+	sets     map[string][]map[string]any
+	faults   []*Fault
+	requests map[string]int
+}
+
+// NewServer starts a Server holding the given store records. Close it when
+// done.
+func NewServer(stores []map[string]any) *Server {
+	s := &Server{
+		sets:     make(map[string][]map[string]any),
+		requests: make(map[string]int),
+	}
+	s.SetStores(stores)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+// NewTLSServer is like NewServer but serves HTTPS with a self-signed
+// certificate, see CAFile. With clientCAs set, it requires client
+// certificates signed by one of them.
+func NewTLSServer(stores []map[string]any, clientCAs *x509.CertPool) *Server {
+	s := &Server{
+		sets:     make(map[string][]map[string]any),
+		requests: make(map[string]int),
+	}
+	s.SetStores(stores)
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serve))
+	if clientCAs != nil {
+		s.Server.TLS = &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCAs,
+		}
+	}
+	s.Server.StartTLS()
+
+	return s
+}
+
+// CAFile writes the certificate of a TLS server to dir as PEM, for use as
+// the client's CA bundle, and returns the file path.
+func (s *Server) CAFile(dir string) (string, error) {
+	path := filepath.Join(dir, "esbtest-ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// SetStores replaces the fixture set, e.g. to simulate changes during a run.
+func (s *Server) SetStores(stores []map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stores = append([]map[string]any(nil), stores...)
+}
+
+// SetEntitySet serves records as the entity set named set, e.g.
+// "LegalEntitiesESB".
+func (s *Server) SetEntitySet(set string, records []map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sets[set] = append([]map[string]any(nil), records...)
+}
+
+// Inject adds a fault. Faults are checked in the order they were added and
+// the first matching one with remaining uses applies.
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// Requests returns how many requests were made to path.
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	fault := s.fault(r)
+	set, isCount := strings.CutSuffix(r.URL.Path, "/$count")
+	records, ok := s.stores, set == storesPath
+	if !ok {
+		records, ok = s.sets[strings.TrimPrefix(set, "/")]
+	}
+	s.mu.Unlock()
+
+	if fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if s.Authorize != nil && !s.Authorize(r) {
+		writeJSON(w, http.StatusUnauthorized, odataError("Unauthorized", "invalid or missing token"))
+		return
+	}
+
+	if fault.Status != 0 {
+		if fault.RetryAfter != "" {
+			w.Header().Set("Retry-After", fault.RetryAfter)
+		}
+		writeJSON(w, fault.Status, odataError(strconv.Itoa(fault.Status), http.StatusText(fault.Status)))
+		return
+	}
+
+	if fault.Body != "" {
+		w.Header().Set("Content-Type", fault.ContentType)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(fault.Body))
+		return
+	}
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, odataError("NotFound", r.URL.Path))
+		return
+	}
+
+	q := r.URL.Query()
+	pred, err := parseFilter(queryParam(q, "filter"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, odataError("BadRequest", err.Error()))
+		return
+	}
+
+	var matched []map[string]any
+	for _, rec := range records {
+		if pred(rec) {
+			matched = append(matched, rec)
+		}
+	}
+
+	if isCount {
+		// ESB prefixes the plain-text count with a byte order mark.
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintf(w, "\uFEFF%d", len(matched)+fault.CountDelta)
+		return
+	}
+	s.servePage(w, r, matched, fault)
+}
+
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request, matched []map[string]any, fault Fault) {
+	q := r.URL.Query()
+
+	if orderBy := queryParam(q, "orderby"); orderBy != "" {
+		if err := sortRecords(matched, orderBy); err != nil {
+			writeJSON(w, http.StatusBadRequest, odataError("BadRequest", err.Error()))
+			return
+		}
+	}
+
+	skip, err := intParam(q, "skip", 0)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, odataError("BadRequest", err.Error()))
+		return
+	}
+	top, err := intParam(q, "top", -1)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, odataError("BadRequest", err.Error()))
+		return
+	}
+
+	total := len(matched)
+	page := matched[min(skip, total):]
+	if top >= 0 {
+		page = page[:min(top, len(page))]
+	}
+
+	res := map[string]any{}
+	if maxPageSize := preferMaxPageSize(r); maxPageSize > 0 && len(page) > maxPageSize {
+		page = page[:maxPageSize]
+
+		next := *r.URL
+		nq := next.Query()
+		nq.Del("$skip")
+		nq.Set("skip", strconv.Itoa(skip+maxPageSize))
+		if top >= 0 {
+			nq.Del("$top")
+			nq.Set("top", strconv.Itoa(top-maxPageSize))
+		}
+		nq.Del("count")
+		nq.Del("$count")
+		next.RawQuery = nq.Encode()
+		res["@odata.nextLink"] = s.URL + next.RequestURI()
+	}
+	if queryParam(q, "count") == "true" {
+		res["@odata.count"] = total + fault.CountDelta
+	}
+
+	fields := selectParam(q)
+	value := make([]map[string]any, 0, len(page))
+	for _, st := range page {
+		value = append(value, project(st, fields))
+	}
+	res["value"] = value
+
+	if fault.MalformedJSON {
+		b, _ := json.Marshal(res)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b[:len(b)/2])
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// fault returns the fault for r, consuming one use. Called with s.mu held.
+func (s *Server) fault(r *http.Request) Fault {
+	for i, f := range s.faults {
+		if f.Match != nil && !f.Match(r) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return *f
+	}
+	return Fault{}
+}
+
+func queryParam(q url.Values, name string) string {
+	if v := q.Get("$" + name); v != "" {
+		return v
+	}
+	return q.Get(name)
+}
+
+func intParam(q url.Values, name string, def int) (int, error) {
+	v := queryParam(q, name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid $%s %q", name, v)
+	}
+	return n, nil
+}
+
+func selectParam(q url.Values) []string {
+	v := queryParam(q, "select")
+	if v == "" {
+		return nil
+	}
+
+	var fields []string
+	for _, f := range strings.Split(v, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func preferMaxPageSize(r *http.Request) int {
+	for _, pref := range strings.Split(r.Header.Get("Prefer"), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pref), "=")
+		if ok && strings.EqualFold(k, "odata.maxpagesize") {
+			n, _ := strconv.Atoi(v)
+			return n
+		}
+	}
+	return 0
+}
+
+func project(record map[string]any, fields []string) map[string]any {
+	if len(fields) == 0 {
+		return record
+	}
+
+	out := make(map[string]any, len(fields))
+	for _, f := range fields {
+		if v, ok := record[f]; ok {
+			out[f] = v
+		}
+	}
+	return out
+}
+
+func odataError(code, message string) map[string]any {
+	return map[string]any{
+		"error": map[string]string{
+			"code":    code,
+			"message": message,
+		},
+	}
+}
@@ -0,0 +1,134 @@
+// Package esbtest provides in-process stand-ins for the ESB services,
+// for use in tests and local runs that cannot reach the corporate network.
+package esbtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// TokenServer is an OAuth2 token endpoint issuing opaque bearer tokens
+// with the client credentials grant.
+type TokenServer struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+	TTL          time.Duration
+	// OmitExpiresIn leaves expires_in out of token responses, which RFC
+	// 6749 allows.
+	OmitExpiresIn bool
+
+	mu       sync.Mutex
+	tokens   map[string]time.Time
+	requests int
+}
+
+// NewTokenServer starts a TokenServer that accepts the given client
+// credentials and issues tokens valid for ttl. Close it when done.
+func NewTokenServer(clientID, clientSecret string, ttl time.Duration) *TokenServer {
+	s := &TokenServer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TTL:          ttl,
+		tokens:       make(map[string]time.Time),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveToken))
+
+	return s
+}
+
+// TokenURL returns the URL to configure as ESB_OAUTH_TOKEN_URL.
+func (s *TokenServer) TokenURL() string {
+	return s.URL + "/token"
+}
+
+// Valid reports whether token was issued by s and has not expired yet.
+func (s *TokenServer) Valid(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiry, ok := s.tokens[token]
+	return ok && time.Now().Before(expiry)
+}
+
+// Revoke invalidates every issued token, as if the server rotated its keys.
+func (s *TokenServer) Revoke() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.tokens)
+}
+
+// Requests returns the number of token requests served so far.
+func (s *TokenServer) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// Authorized reports whether req carries a valid bearer token from s.
+func (s *TokenServer) Authorized(req *http.Request) bool {
+	const prefix = "Bearer "
+
+	h := req.Header.Get("Authorization")
+	if len(h) <= len(prefix) || h[:len(prefix)] != prefix {
+		return false
+	}
+
+	return s.Valid(h[len(prefix):])
+}
+
+func (s *TokenServer) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/token" {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "client_credentials" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != s.ClientID || secret != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	token := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	s.tokens[token] = time.Now().Add(s.TTL)
+	s.requests++
+	s.mu.Unlock()
+
+	res := map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+	}
+	if !s.OmitExpiresIn {
+		res["expires_in"] = int(s.TTL.Seconds())
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,152 @@
+package esb
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"go-esb-store/pkg/logger"
+)
+
+// endpoint is an ESB gateway with its health over the run.
+type endpoint struct {
+	url      url.URL
+	failures int
+	lastErr  string
+}
+
+// failoverDoer sends requests to the active one of several equivalent ESB
+// gateways. Requests are built against the first gateway; the doer moves
+// them to the active one. On a connection error or 5xx the gateway is marked
+// failed and the request goes to the next one, which then stays active for
+// the rest of the run. Requests to other hosts, e.g. the OAuth2 token
+// endpoint, pass through untouched.
+type failoverDoer struct {
+	next HttpRequestDoer
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	active    int
+}
+
+func newFailoverDoer(next HttpRequestDoer, urls []url.URL) *failoverDoer {
+	endpoints := make([]*endpoint, 0, len(urls))
+	for _, u := range urls {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = ""
+		endpoints = append(endpoints, &endpoint{url: u})
+	}
+
+	return &failoverDoer{
+		next:      next,
+		endpoints: endpoints,
+	}
+}
+
+func (d *failoverDoer) Do(req *http.Request) (*http.Response, error) {
+	from := d.match(req.URL)
+	if from < 0 {
+		return d.next.Do(req)
+	}
+
+	d.mu.Lock()
+	start := d.active
+	d.mu.Unlock()
+
+	var (
+		res *http.Response
+		err error
+	)
+	for i := range d.endpoints {
+		to := (start + i) % len(d.endpoints)
+
+		r, cerr := cloneRequest(req)
+		if cerr != nil {
+			return nil, cerr
+		}
+		d.rewrite(r.URL, from, to)
+
+		res, err = d.next.Do(r)
+		if req.Context().Err() != nil {
+			return res, err
+		}
+
+		reason := failoverReason(res, err)
+		if reason == "" {
+			return res, err
+		}
+		d.fail(to, reason)
+
+		if i < len(d.endpoints)-1 && res != nil {
+			drainBody(res)
+		}
+	}
+
+	return res, err
+}
+
+// match returns the index of the endpoint u belongs to, or -1.
+func (d *failoverDoer) match(u *url.URL) int {
+	for i, e := range d.endpoints {
+		if u.Scheme == e.url.Scheme && u.Host == e.url.Host && strings.HasPrefix(u.Path, e.url.Path) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *failoverDoer) rewrite(u *url.URL, from, to int) {
+	if from == to {
+		return
+	}
+
+	src, dst := d.endpoints[from].url, d.endpoints[to].url
+	u.Scheme = dst.Scheme
+	u.Host = dst.Host
+	u.User = dst.User
+	u.Path = dst.Path + strings.TrimPrefix(u.Path, src.Path)
+	u.RawPath = ""
+}
+
+// fail records a failure of endpoint i and, if it is the active one, makes
+// the next endpoint active. Concurrent failures of the same endpoint move
+// on only once.
+func (d *failoverDoer) fail(i int, reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e := d.endpoints[i]
+	e.failures++
+	e.lastErr = reason
+
+	if d.active != i {
+		return
+	}
+	d.active = (i + 1) % len(d.endpoints)
+	logger.Warn(
+		"esb.failoverDoer: switching endpoint",
+		"from", e.url.Host,
+		"to", d.endpoints[d.active].url.Host,
+		"reason", reason,
+		"failures", e.failures,
+	)
+}
+
+func failoverReason(res *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	if res.StatusCode >= http.StatusInternalServerError {
+		return res.Status
+	}
+	return ""
+}
+
+// servedBy names the endpoint that answered res.
+func servedBy(res *http.Response) string {
+	if res == nil || res.Request == nil {
+		return ""
+	}
+	return res.Request.URL.Scheme + "://" + res.Request.URL.Host
+}
@@ -0,0 +1,59 @@
+package esb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go-esb-store/internal/utils"
+)
+
+const modifiedField = "ModifiedDateTime"
+
+// BuildFilter builds an OData $filter expression that matches stores of any
+// of the given countries and, if extra is not empty, the extra predicate.
+func BuildFilter(countries []string, extra string) string {
+	var preds []string
+	for _, c := range countries {
+		if c = utils.CleanString(c); c != "" {
+			preds = append(preds, fmt.Sprintf("PrimaryCountryRegionId eq %s", quoteOData(c)))
+		}
+	}
+
+	var parts []string
+	switch len(preds) {
+	case 0:
+	case 1:
+		parts = append(parts, preds[0])
+	default:
+		parts = append(parts, "("+strings.Join(preds, " or ")+")")
+	}
+
+	if extra = utils.CleanString(extra); extra != "" {
+		if len(parts) == 0 {
+			return extra
+		}
+		parts = append(parts, "("+extra+")")
+	}
+
+	return strings.Join(parts, " and ")
+}
+
+// ModifiedSince returns a copy of the client that only fetches stores
+// modified at or after t. An empty result is not an error for such a client.
+func (c *ClientWithDefaults) ModifiedSince(t time.Time) *ClientWithDefaults {
+	pred := fmt.Sprintf("%s ge %s", modifiedField, t.UTC().Format(time.RFC3339))
+
+	d := *c
+	d.Filter = BuildFilter(nil, pred)
+	if c.Filter != "" {
+		d.Filter = fmt.Sprintf("(%s) and %s", c.Filter, pred)
+	}
+	d.AllowEmpty = true
+
+	return &d
+}
+
+func quoteOData(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,178 @@
+package esb
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go-esb-store/pkg/logger"
+)
+
+// Pagination selects how ClientWithDefaults walks through store pages.
+type Pagination string
+
+const (
+	// PaginationSkip fetches $skip/$top pages concurrently, sized by $count.
+	PaginationSkip Pagination = "skip"
+	// PaginationNextLink follows @odata.nextLink sequentially until exhausted,
+	// for environments that ignore $count or enforce server-driven paging.
+	PaginationNextLink Pagination = "nextlink"
+)
+
+// pagesByLink requests the first page with an inline count and then
+// follows @odata.nextLink. The page size is only a hint sent via
+// Prefer: odata.maxpagesize, because $top would cap the whole result.
+func (p *pager[T]) pagesByLink(ctx context.Context) iter.Seq2[[]T, error] {
+	return func(yield func([]T, error) bool) {
+		var (
+			seen  = make(map[string]struct{})
+			links = make(map[string]struct{})
+			count *int
+			next  string
+		)
+
+		for page := 0; ; page++ {
+			start := time.Now()
+
+			res, err := p.link(ctx, page, next)
+			if err != nil {
+				logger.Error("esb.pagesByLink: page failed", "error", err, "set", p.set, "page", page, "latency", time.Since(start))
+				if p.Partial {
+					yield(nil, &PageError{Page: page, Err: err})
+					return
+				}
+				yield(nil, fmt.Errorf("page %d: %w", page, err))
+				return
+			}
+
+			if res.count != nil {
+				count = res.count
+			}
+			logger.Debug("esb.pagesByLink: page fetched", "set", p.set, "page", page, "count", len(res.values), "latency", time.Since(start))
+
+			if fresh := p.dropSeen(res.values, seen); len(fresh) > 0 {
+				if !yield(fresh, nil) {
+					return
+				}
+			}
+
+			if res.next == "" {
+				break
+			}
+			next = res.next
+			if _, ok := links[next]; ok {
+				err = fmt.Errorf("%w: %s", ErrNextLinkLoop, next)
+				logger.Error("esb.pagesByLink: error getting records", "error", err, "set", p.set, "page", page)
+				yield(nil, err)
+				return
+			}
+			links[next] = struct{}{}
+		}
+
+		if count != nil && *count != len(seen) {
+			err := fmt.Errorf("%w: %s: expected %d, got %d", ErrCountMismatch, p.set, *count, len(seen))
+			logger.Error("esb.pagesByLink: error getting records", "error", err)
+			yield(nil, err)
+			return
+		}
+
+		if len(seen) == 0 && !p.AllowEmpty {
+			err := fmt.Errorf("%w: %s", ErrNoData, p.set)
+			logger.Error(fmt.Sprintf("esb.pagesByLink: %s", err))
+			yield(nil, err)
+			return
+		}
+
+		logger.Info("esb.pagesByLink: got records", "set", p.set, "count", len(seen), "pages", len(links)+1)
+	}
+}
+
+// getStoresLinkPage fetches the first store page with an inline count if
+// link is empty, or the page link points to otherwise.
+func (c *ClientWithDefaults) getStoresLinkPage(ctx context.Context, page int, link string) (*linkPage[Store], error) {
+	var (
+		rsp *http.Response
+		err error
+	)
+	if link == "" {
+		withCount := true
+		orderBy := storesOrderBy
+
+		rsp, err = c.ClientInterface.GetStores(
+			ctx,
+			&GetStoresParams{
+				Count:   &withCount,
+				Filter:  c.filter(),
+				Orderby: &orderBy,
+				Select:  c.selectFields(page),
+			},
+			c.preferPageSize,
+		)
+	} else {
+		rsp, err = c.send(ctx, link, c.preferPageSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.parseStoresPage(ctx, page, rsp)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedStatus, res.Status())
+	}
+
+	out := &linkPage[Store]{}
+	if res.JSON200 == nil {
+		return out, nil
+	}
+	if res.JSON200.Value != nil {
+		out.values = *res.JSON200.Value
+	}
+	if res.JSON200.OdataNextLink != nil {
+		out.next = *res.JSON200.OdataNextLink
+	}
+	out.count = res.JSON200.OdataCount
+
+	return out, nil
+}
+
+// send issues a GET for ref, resolved against the server URL, through the
+// doer chain of the client, e.g. for a next link or an entity set that the
+// generated client does not know.
+func (c *ClientWithDefaults) send(ctx context.Context, ref string, editors ...RequestEditorFn) (*http.Response, error) {
+	client, ok := c.ClientInterface.(*Client)
+	if !ok {
+		return nil, fmt.Errorf("raw requests require *esb.Client, got %T", c.ClientInterface)
+	}
+
+	server, err := url.Parse(client.Server)
+	if err != nil {
+		return nil, err
+	}
+	u, err := server.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = client.applyEditors(ctx, req, editors); err != nil {
+		return nil, err
+	}
+
+	return client.Client.Do(req)
+}
+
+func (c *ClientWithDefaults) preferPageSize(_ context.Context, req *http.Request) error {
+	if c.PageSize > 0 {
+		req.Header.Set("Prefer", fmt.Sprintf("odata.maxpagesize=%d", c.PageSize))
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package esb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"iter"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-esb-store/pkg/logger"
+)
+
+// pager walks the pages of one entity set with the settings of the client:
+// page size, concurrency, pagination mode, refetches and partial mode. The
+// entity set only supplies how to count records and fetch a page.
+type pager[T any] struct {
+	*ClientWithDefaults
+	// set names the entity set in logs and errors.
+	set string
+	// count returns the number of records matching the filter.
+	count func(ctx context.Context) (int, error)
+	// page fetches the $skip/$top page with the given index.
+	page func(ctx context.Context, page int) ([]T, error)
+	// link fetches the first server-driven page if link is empty, or the
+	// page link points to otherwise.
+	link func(ctx context.Context, page int, link string) (*linkPage[T], error)
+	// key identifies a record, so the same record returned by two pages,
+	// e.g. after a page shift, is yielded once. Records it returns an empty
+	// key for are identified by their whole content.
+	key func(v T) string
+}
+
+// linkPage is a page of server-driven paging.
+type linkPage[T any] struct {
+	values []T
+	count  *int
+	next   string
+}
+
+// pageResult is a fetched page or, in partial mode, a failed one.
+type pageResult[T any] struct {
+	values []T
+	err    *PageError
+}
+
+func (p *pager[T]) pages(ctx context.Context) iter.Seq2[[]T, error] {
+	if p.Pagination == PaginationNextLink {
+		return p.pagesByLink(ctx)
+	}
+	return p.pagesBySkip(ctx)
+}
+
+// pagesBySkip fetches $skip/$top pages concurrently and yields them in
+// completion order. At most MaxConcurrency pages are fetched ahead of the
+// consumer, so memory stays bounded by page size. If the number of distinct
+// records differs from $count, the pages are fetched again up to
+// RefetchAttempts times before ErrCountMismatch is yielded.
+func (p *pager[T]) pagesBySkip(ctx context.Context) iter.Seq2[[]T, error] {
+	return func(yield func([]T, error) bool) {
+		logger.Debug("esb.pagesBySkip: start getting records count", "set", p.set)
+
+		count, err := p.count(ctx)
+		if err != nil {
+			logger.Error("esb.pagesBySkip: error getting records", "error", err, "set", p.set)
+			yield(nil, err)
+			return
+		}
+
+		if count == 0 && p.AllowEmpty {
+			logger.Info("esb.pagesBySkip: no records to fetch", "set", p.set)
+			return
+		}
+
+		seen := make(map[string]struct{}, count)
+		for attempt := 0; ; attempt++ {
+			pages := p.pagesCount(count)
+			if pages < 1 {
+				logger.Error(fmt.Sprintf("esb.pagesBySkip: %s", ErrNoPageToFetch), "set", p.set)
+				yield(nil, ErrNoPageToFetch)
+				return
+			}
+			logger.Debug("esb.pagesBySkip: pages ", "set", p.set, "pages", pages, "attempt", attempt)
+
+			failed, ok := p.streamPages(ctx, pages, seen, yield)
+			if !ok {
+				return
+			}
+			if failed > 0 {
+				logger.Warn("esb.pagesBySkip: got records partially", "set", p.set, "count", len(seen), "expected", count, "failedPages", failed)
+				return
+			}
+			if len(seen) == count {
+				break
+			}
+
+			logger.Warn("esb.pagesBySkip: records count mismatch", "set", p.set, "expected", count, "got", len(seen), "attempt", attempt)
+			if count, err = p.count(ctx); err != nil {
+				logger.Error("esb.pagesBySkip: error getting records", "error", err, "set", p.set)
+				yield(nil, err)
+				return
+			}
+			if len(seen) == count {
+				break
+			}
+			if len(seen) > count || attempt >= p.RefetchAttempts {
+				err = fmt.Errorf("%w: %s: expected %d, got %d", ErrCountMismatch, p.set, count, len(seen))
+				logger.Error("esb.pagesBySkip: error getting records", "error", err)
+				yield(nil, err)
+				return
+			}
+		}
+
+		if len(seen) == 0 && !p.AllowEmpty {
+			err = fmt.Errorf("%w: %s", ErrNoData, p.set)
+			logger.Error(fmt.Sprintf("esb.pagesBySkip: %s", err))
+			yield(nil, err)
+			return
+		}
+
+		logger.Info("esb.pagesBySkip: got records", "set", p.set, "count", len(seen), "limit", p.PageSize)
+	}
+}
+
+// streamPages fetches pages concurrently and yields the records not in seen
+// yet. It returns the number of failed pages in partial mode, and false if
+// the consumer stopped or an error was yielded.
+func (p *pager[T]) streamPages(ctx context.Context, pages int, seen map[string]struct{}, yield func([]T, error) bool) (int, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pageCh := make(chan pageResult[T], p.maxConcurrency())
+	errCh := make(chan error, 1)
+
+	send := func(r pageResult[T]) {
+		select {
+		case pageCh <- r:
+		case <-ctx.Done():
+		}
+	}
+	var onFail func(page int, err error)
+	if p.Partial {
+		onFail = func(page int, err error) {
+			send(pageResult[T]{err: &PageError{Page: page, Err: err}})
+		}
+	}
+
+	go func() {
+		defer close(pageCh)
+		errCh <- p.fetchPages(ctx, pages, func(page int, values []T) {
+			send(pageResult[T]{values: values})
+		}, onFail)
+	}()
+
+	failed := 0
+	for r := range pageCh {
+		var ok bool
+		if r.err != nil {
+			failed++
+			ok = yield(nil, r.err)
+		} else if fresh := p.dropSeen(r.values, seen); len(fresh) > 0 {
+			ok = yield(fresh, nil)
+		} else {
+			continue
+		}
+
+		if !ok {
+			cancel()
+			for range pageCh {
+			}
+			return failed, false
+		}
+	}
+
+	if err := <-errCh; err != nil {
+		logger.Error("esb.streamPages: error getting records", "error", err, "set", p.set)
+		yield(nil, err)
+		return failed, false
+	}
+
+	return failed, true
+}
+
+// fetchPages fetches pages [0, pages) with at most MaxConcurrency requests
+// in flight and hands every page to fn, which may be called concurrently.
+// A failed page is handed to onFail; if onFail is nil, the first failed page
+// cancels the rest.
+func (p *pager[T]) fetchPages(ctx context.Context, pages int, fn func(page int, values []T), onFail func(page int, err error)) error {
+	workers := min(p.maxConcurrency(), pages)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	errCh := make(chan error, 1)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for page := range jobs {
+				start := time.Now()
+				values, err := p.page(ctx, page)
+				if err != nil {
+					logger.Error("esb.fetchPages: page failed", "error", err, "set", p.set, "page", page, "latency", time.Since(start))
+					if onFail != nil && ctx.Err() == nil {
+						onFail(page, err)
+						continue
+					}
+					select {
+					case errCh <- fmt.Errorf("page %d: %w", page, err):
+						cancel()
+					default:
+					}
+					continue
+				}
+				logger.Debug("esb.fetchPages: page fetched", "set", p.set, "page", page, "count", len(values), "latency", time.Since(start))
+
+				if len(values) > 0 {
+					fn(page, values)
+				}
+			}
+		}()
+	}
+
+feed:
+	for page := 0; page < pages; page++ {
+		select {
+		case jobs <- page:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// dropSeen returns the records not in seen yet and records them as seen.
+// The first version of a record wins.
+func (p *pager[T]) dropSeen(values []T, seen map[string]struct{}) []T {
+	fresh := make([]T, 0, len(values))
+	for _, v := range values {
+		key := p.key(v)
+		if key == "" {
+			key = fingerprint(v)
+		}
+		if _, ok := seen[key]; ok {
+			logger.Debug("esb.dropSeen: duplicate record dropped", "set", p.set, "key", key, "record", v)
+			continue
+		}
+		seen[key] = struct{}{}
+		fresh = append(fresh, v)
+	}
+
+	return fresh
+}
+
+// fingerprint identifies a record by its whole content, for records
+// without a key.
+func fingerprint(v any) string {
+	b, _ := json.Marshal(v)
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	return "#" + strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,109 @@
+package esb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func testStore(country, number, name string) Store {
+	return Store{PrimaryCountryRegionId: ptr(country), StoreFactsNumber: ptr(number), NameAlias: ptr(name)}
+}
+
+// TestPagesBySkipDropsShiftedStore simulates a store that changed while
+// paging: page 1 shifted back and returns store 2 again, in a newer
+// version, while the count still holds the three distinct stores.
+func TestPagesBySkipDropsShiftedStore(t *testing.T) {
+	pages := map[int][]Store{
+		0: {testStore("RUS", "1", "a"), testStore("RUS", "2", "b")},
+		1: {testStore("RUS", "2", "b, renamed"), testStore("RUS", "3", "c")},
+	}
+	p := &pager[Store]{
+		ClientWithDefaults: &ClientWithDefaults{PageSize: 2, MaxConcurrency: 1},
+		set:                storesEntitySet,
+		count:              func(context.Context) (int, error) { return 3, nil },
+		page: func(_ context.Context, page int) ([]Store, error) {
+			return pages[page], nil
+		},
+		key: storeKey,
+	}
+
+	var got []Store
+	for page, err := range p.pagesBySkip(context.Background()) {
+		if err != nil {
+			t.Fatalf("pagesBySkip() error = %v", err)
+		}
+		got = append(got, page...)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("got %d stores, want 3", len(got))
+	}
+	for _, s := range got {
+		if *s.StoreFactsNumber == "2" && *s.NameAlias != "b" {
+			t.Errorf("store 2 = %q, want the first version", *s.NameAlias)
+		}
+	}
+}
+
+func TestPagesBySkipKeysByCountry(t *testing.T) {
+	p := &pager[Store]{
+		ClientWithDefaults: &ClientWithDefaults{PageSize: 2, MaxConcurrency: 1},
+		set:                storesEntitySet,
+		count:              func(context.Context) (int, error) { return 2, nil },
+		page: func(context.Context, int) ([]Store, error) {
+			return []Store{testStore("RUS", "1", "a"), testStore("KAZ", "1", "b")}, nil
+		},
+		key: storeKey,
+	}
+
+	n := 0
+	for page, err := range p.pagesBySkip(context.Background()) {
+		if err != nil {
+			t.Fatalf("pagesBySkip() error = %v", err)
+		}
+		n += len(page)
+	}
+	if n != 2 {
+		t.Errorf("got %d stores, want 2", n)
+	}
+}
+
+func TestPagesBySkipCountMismatch(t *testing.T) {
+	p := &pager[Store]{
+		ClientWithDefaults: &ClientWithDefaults{PageSize: 2, MaxConcurrency: 1},
+		set:                storesEntitySet,
+		count:              func(context.Context) (int, error) { return 3, nil },
+		page: func(_ context.Context, page int) ([]Store, error) {
+			if page > 0 {
+				return nil, nil
+			}
+			return []Store{testStore("RUS", "1", "a"), testStore("RUS", "1", "a, again")}, nil
+		},
+		key: storeKey,
+	}
+
+	var err error
+	for _, err = range p.pagesBySkip(context.Background()) {
+	}
+	if !errors.Is(err, ErrCountMismatch) {
+		t.Errorf("pagesBySkip() error = %v, want %v", err, ErrCountMismatch)
+	}
+}
+
+func TestRecordKey(t *testing.T) {
+	r := Record{"Id": "7", "Country": "RUS"}
+	if got := recordKey(r, []string{"Country", "Id"}); got != "RUS/7" {
+		t.Errorf("recordKey() = %q, want RUS/7", got)
+	}
+	if got := recordKey(r, []string{"Missing"}); got != "" {
+		t.Errorf("recordKey() = %q, want empty", got)
+	}
+	if got := recordKey(r, nil); got != "" {
+		t.Errorf("recordKey() = %q, want empty", got)
+	}
+}
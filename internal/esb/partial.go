@@ -0,0 +1,57 @@
+package esb
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PageError reports a page that failed in partial mode. StorePages and
+// EntityPages yield it in place of the page and, with $skip paging, keep
+// yielding the others.
+type PageError struct {
+	Page int
+	Err  error
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("page %d: %s", e.Page, e.Err)
+}
+
+func (e *PageError) Unwrap() error {
+	return e.Err
+}
+
+// PartialError is returned by GetStores in partial mode together with the
+// stores of the pages that succeeded.
+type PartialError struct {
+	Failed []*PageError
+}
+
+// Pages returns the indices of the failed pages in ascending order.
+func (e *PartialError) Pages() []int {
+	pages := make([]int, 0, len(e.Failed))
+	for _, f := range e.Failed {
+		pages = append(pages, f.Page)
+	}
+	slices.Sort(pages)
+
+	return pages
+}
+
+func (e *PartialError) Error() string {
+	pages := make([]string, 0, len(e.Failed))
+	for _, p := range e.Pages() {
+		pages = append(pages, strconv.Itoa(p))
+	}
+	return fmt.Sprintf("failed pages: %s", strings.Join(pages, ", "))
+}
+
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, f := range e.Failed {
+		errs = append(errs, f)
+	}
+	return errs
+}
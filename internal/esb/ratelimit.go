@@ -0,0 +1,126 @@
+package esb
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"go-esb-store/pkg/logger"
+)
+
+// rateLimiter is a token bucket refilled at rate tokens per second up to
+// burst tokens. Pause empties the bucket and blocks it for a while, which is
+// how a Retry-After from the gateway slows every caller down at once.
+type rateLimiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token if one is available and returns zero, otherwise it
+// returns how long to wait before trying again.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+func (l *rateLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.tokens = 0
+}
+
+// rateLimitDoer waits for a token before every request and feeds the
+// Retry-After of 429 responses back into the limiter. Every host has a
+// bucket of its own: the doer sits below failoverDoer, so each attempt on a
+// gateway takes a token from that gateway, and a failover to a secondary
+// is neither held back nor paid for by the throttled primary.
+type rateLimitDoer struct {
+	next  HttpRequestDoer
+	rate  float64
+	burst int
+
+	mu       sync.Mutex
+	limiters map[string]*rateLimiter
+}
+
+func newRateLimitDoer(next HttpRequestDoer, rate float64, burst int) *rateLimitDoer {
+	return &rateLimitDoer{
+		next:     next,
+		rate:     rate,
+		burst:    burst,
+		limiters: make(map[string]*rateLimiter),
+	}
+}
+
+// limiter returns the bucket of host, creating it on first use.
+func (d *rateLimitDoer) limiter(host string) *rateLimiter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	l, ok := d.limiters[host]
+	if !ok {
+		l = newRateLimiter(d.rate, d.burst)
+		d.limiters[host] = l
+	}
+	return l
+}
+
+func (d *rateLimitDoer) Do(req *http.Request) (*http.Response, error) {
+	limiter := d.limiter(req.URL.Host)
+	for {
+		delay := limiter.reserve(time.Now())
+		if delay == 0 {
+			break
+		}
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := d.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		if retryAfter := parseRetryAfter(res.Header.Get("Retry-After")); retryAfter > 0 {
+			logger.Warn("esb.rateLimitDoer.Do: throttled by server, pausing requests", "host", req.URL.Host, "retry_after", retryAfter)
+			limiter.pause(retryAfter)
+		}
+	}
+
+	return res, nil
+}
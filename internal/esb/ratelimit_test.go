@@ -0,0 +1,86 @@
+package esb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimitPerEndpoint(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		hosts []string
+	)
+	next := doerFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		hosts = append(hosts, req.URL.Host)
+		mu.Unlock()
+		if req.URL.Host == "primary.example" {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Status: "503", Body: http.NoBody}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	// One token an hour: every gateway gets exactly one request.
+	limited := newRateLimitDoer(next, 1.0/3600, 1)
+	doer := newFailoverDoer(limited, []url.URL{
+		{Scheme: "https", Host: "primary.example", Path: "/esb"},
+		{Scheme: "https", Host: "secondary.example", Path: "/esb"},
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "https://primary.example/esb/RetailStoresESB", nil)
+	res, err := doer.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Do() status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("requests = %v, want one per gateway", hosts)
+	}
+
+	// The secondary is active now and its bucket is empty.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, "https://primary.example/esb/RetailStoresESB", nil)
+	if _, err = doer.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if len(hosts) != 2 {
+		t.Errorf("requests = %v, want no request past the limit", hosts)
+	}
+}
+
+func TestRateLimitRetryAfterPausesHost(t *testing.T) {
+	next := doerFunc(func(req *http.Request) (*http.Response, error) {
+		res := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}
+		if req.URL.Host == "throttled.example" {
+			res.StatusCode = http.StatusTooManyRequests
+			res.Header.Set("Retry-After", "3600")
+		}
+		return res, nil
+	})
+	doer := newRateLimitDoer(next, 1000, 10)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://throttled.example/", nil)
+	if _, err := doer.Do(req); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "https://other.example/", nil)
+	if _, err := doer.Do(req); err != nil {
+		t.Errorf("Do() on another host error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, "https://throttled.example/", nil)
+	if _, err := doer.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() on paused host error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
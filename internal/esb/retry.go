@@ -0,0 +1,215 @@
+package esb
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go-esb-store/pkg/logger"
+)
+
+// RetryPolicy describes how failed ESB requests are retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// retryDoer wraps an HttpRequestDoer and retries transient failures
+// with exponential backoff and full jitter, honoring Retry-After.
+type retryDoer struct {
+	next   HttpRequestDoer
+	policy RetryPolicy
+}
+
+func newRetryDoer(next HttpRequestDoer, policy RetryPolicy) *retryDoer {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return &retryDoer{
+		next:   next,
+		policy: policy,
+	}
+}
+
+func (d *retryDoer) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 1; ; attempt++ {
+		r, err := cloneRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := d.next.Do(r)
+		if err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+
+		retryable, retryAfter := classify(res, err)
+		if !retryable {
+			return res, err
+		}
+		if attempt >= d.policy.MaxAttempts {
+			if err != nil {
+				return nil, fmt.Errorf("%w after %d attempts: %w", ErrRetriesExhausted, attempt, err)
+			}
+			return res, nil
+		}
+
+		delay := d.backoff(attempt, retryAfter)
+		if res != nil {
+			logger.Warn("esb.retryDoer.Do: retryable response", "status", res.Status, "attempt", attempt, "delay", delay, "url", req.URL.Path)
+			drainBody(res)
+		} else {
+			logger.Warn("esb.retryDoer.Do: retryable error", "error", err, "attempt", attempt, "delay", delay, "url", req.URL.Path)
+		}
+
+		if err = sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt. A Retry-After hint
+// from the server takes precedence over the computed exponential delay.
+func (d *retryDoer) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if d.policy.MaxDelay > 0 {
+			return min(retryAfter, d.policy.MaxDelay)
+		}
+		return retryAfter
+	}
+
+	delay := d.policy.BaseDelay << (attempt - 1)
+	if d.policy.MaxDelay > 0 && (delay <= 0 || delay > d.policy.MaxDelay) {
+		delay = d.policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return rand.N(delay) + 1
+}
+
+// classify splits failures into retryable and permanent ones.
+// Transport errors, 429 and gateway 5xx errors are retryable,
+// every other status is permanent, and so are the transport errors
+// permanentError reports.
+func classify(res *http.Response, err error) (bool, time.Duration) {
+	if err != nil {
+		return !permanentError(err), 0
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true, parseRetryAfter(res.Header.Get("Retry-After"))
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true, 0
+	default:
+		return false, 0
+	}
+}
+
+// permanentError reports transport errors a retry cannot fix: a canceled
+// or expired context, a failed certificate verification, an unknown host
+// and a malformed URL, also when wrapped in the url.Error of http.Client.
+func permanentError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return true
+	}
+
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return true
+	}
+	var unknownAuthority x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthority) {
+		return true
+	}
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return true
+	}
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		// The timeout of a single attempt (http.Client.Timeout) also
+		// matches context.DeadlineExceeded with errors.Is, but is worth a
+		// retry; only the expired context itself is permanent.
+		if e == context.DeadlineExceeded {
+			return true
+		}
+		if urlErr, ok := e.(*url.Error); ok && urlErr.Op == "parse" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseRetryAfter accepts both delay-seconds and HTTP-date forms.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		if sec < 0 {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.Body == nil || req.GetBody == nil {
+		return r, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = body
+
+	return r, nil
+}
+
+func drainBody(res *http.Response) {
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package esb
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	_, parseErr := url.Parse("https://esb example/%zz")
+	clientTimeout := &http.Client{Timeout: time.Nanosecond}
+	_, attemptTimeout := clientTimeout.Get("http://192.0.2.1/")
+
+	tests := []struct {
+		name      string
+		status    int
+		err       error
+		retryable bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "bad request", status: http.StatusBadRequest},
+		{name: "not found", status: http.StatusNotFound},
+		{name: "internal error", status: http.StatusInternalServerError},
+		{name: "too many requests", status: http.StatusTooManyRequests, retryable: true},
+		{name: "bad gateway", status: http.StatusBadGateway, retryable: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, retryable: true},
+		{name: "gateway timeout", status: http.StatusGatewayTimeout, retryable: true},
+
+		{name: "connection refused", err: urlErrorOf(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), retryable: true},
+		{name: "connection reset", err: urlErrorOf(syscall.ECONNRESET), retryable: true},
+		{name: "dns timeout", err: urlErrorOf(&net.DNSError{Name: "esb.example", IsTimeout: true}), retryable: true},
+		{name: "attempt timeout", err: attemptTimeout, retryable: true},
+
+		{name: "canceled", err: urlErrorOf(context.Canceled)},
+		{name: "deadline", err: urlErrorOf(context.DeadlineExceeded)},
+		{name: "unknown host", err: urlErrorOf(&net.OpError{Op: "dial", Err: &net.DNSError{Name: "esb.example", IsNotFound: true}})},
+		{name: "certificate", err: urlErrorOf(&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}})},
+		{name: "unknown authority", err: urlErrorOf(x509.UnknownAuthorityError{})},
+		{name: "hostname", err: urlErrorOf(x509.HostnameError{Host: "esb.example"})},
+		{name: "malformed url", err: parseErr},
+		{name: "wrapped malformed url", err: fmt.Errorf("build request: %w", parseErr)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res *http.Response
+			if tt.err == nil {
+				res = &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			}
+			if got, _ := classify(res, tt.err); got != tt.retryable {
+				t.Errorf("classify() = %t, want %t (err %v)", got, tt.retryable, tt.err)
+			}
+		})
+	}
+}
+
+func TestClassifyRetryAfter(t *testing.T) {
+	res := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"7"}}}
+	if _, after := classify(res, nil); after != 7*time.Second {
+		t.Errorf("retry after = %s, want 7s", after)
+	}
+}
+
+func TestPermanentErrorIsNotRetried(t *testing.T) {
+	calls := 0
+	d := newRetryDoer(doerFunc(func(*http.Request) (*http.Response, error) {
+		calls++
+		return nil, urlErrorOf(&net.DNSError{Name: "esb.example", IsNotFound: true})
+	}), RetryPolicy{MaxAttempts: 5})
+
+	req, _ := http.NewRequest(http.MethodGet, "https://esb.example/odata", nil)
+	if _, err := d.Do(req); err == nil || errors.Is(err, ErrRetriesExhausted) {
+		t.Fatalf("Do() error = %v, want the permanent error", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func urlErrorOf(err error) error {
+	return &url.Error{Op: "Get", URL: "https://esb.example/odata", Err: err}
+}
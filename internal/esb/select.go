@@ -0,0 +1,35 @@
+package esb
+
+import (
+	"strings"
+
+	"go-esb-store/internal/utils"
+)
+
+// clientFields are the store fields the client relies on itself: the
+// country and number key records across pages and ModifiedDateTime is the
+// delta watermark. They are always selected along with the mapped ones.
+var clientFields = []string{"PrimaryCountryRegionId", "StoreFactsNumber", modifiedField}
+
+// SelectFields joins field lists into a $select value, dropping blanks and
+// repeats while keeping the first occurrence order.
+func SelectFields(lists ...[]string) string {
+	seen := make(map[string]struct{})
+
+	var fields []string
+	for _, list := range lists {
+		for _, f := range list {
+			f = utils.CleanString(f)
+			if f == "" {
+				continue
+			}
+			if _, ok := seen[f]; ok {
+				continue
+			}
+			seen[f] = struct{}{}
+			fields = append(fields, f)
+		}
+	}
+
+	return strings.Join(fields, ",")
+}
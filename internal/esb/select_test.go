@@ -0,0 +1,36 @@
+package esb
+
+import "testing"
+
+func TestNewESBClientSelect(t *testing.T) {
+	cfg := testConfig(t, map[string]string{
+		"ESB_BASE_URL":     "https://esb.example",
+		"ESB_API_KEY":      "key",
+		"ESB_SELECT_EXTRA": "Extra,NameAlias",
+	})
+
+	tests := []struct {
+		name   string
+		fields []string
+		want   string
+	}{
+		{
+			name:   "mapped fields",
+			fields: []string{"StoreFactsNumber", "NameAlias", "BrandId"},
+			want:   "StoreFactsNumber,NameAlias,BrandId,PrimaryCountryRegionId,ModifiedDateTime,Extra",
+		},
+		{name: "no mapping", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewESBClient(cfg, tt.fields)
+			if err != nil {
+				t.Fatalf("NewESBClient() error = %v", err)
+			}
+			if c.Select != tt.want {
+				t.Errorf("Select = %q, want %q", c.Select, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package esb
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed api.yaml
+var apiSpec []byte
+
+// FieldSchema is the expected shape of a record field as described in
+// api.yaml. Enum is empty for fields without an enum.
+type FieldSchema struct {
+	Type   string
+	Format string
+	Enum   []string
+}
+
+type specSchema struct {
+	Ref        string                 `yaml:"$ref"`
+	Type       string                 `yaml:"type"`
+	Format     string                 `yaml:"format"`
+	Enum       []*string              `yaml:"enum"`
+	Properties map[string]*specSchema `yaml:"properties"`
+	Items      *specSchema            `yaml:"items"`
+}
+
+type specResponse struct {
+	Content map[string]struct {
+		Schema *specSchema `yaml:"schema"`
+	} `yaml:"content"`
+}
+
+type specOperation struct {
+	OperationID string                   `yaml:"operationId"`
+	Responses   map[string]*specResponse `yaml:"responses"`
+}
+
+type specDocument struct {
+	Paths      map[string]map[string]*specOperation `yaml:"paths"`
+	Components struct {
+		Schemas map[string]*specSchema `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+var (
+	specOnce   sync.Once
+	specDoc    *specDocument
+	specFields map[string]map[string]FieldSchema
+	specErr    error
+)
+
+func loadSpec() (*specDocument, map[string]map[string]FieldSchema, error) {
+	specOnce.Do(func() {
+		specDoc, specFields, specErr = parseSpec(apiSpec)
+	})
+	return specDoc, specFields, specErr
+}
+
+// SchemaFields returns the fields of a component schema of the embedded
+// api.yaml, with $ref properties resolved.
+func SchemaFields(name string) (map[string]FieldSchema, error) {
+	_, schemaFields, err := loadSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	fields, ok := schemaFields[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: no schema %q", ErrSpec, name)
+	}
+	return fields, nil
+}
+
+// resolve follows a $ref to the referenced component schema.
+func (doc *specDocument) resolve(s *specSchema) (*specSchema, error) {
+	if s == nil || s.Ref == "" {
+		return s, nil
+	}
+
+	ref, ok := doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	if !ok {
+		return nil, fmt.Errorf("%w: unresolved %s", ErrSpec, s.Ref)
+	}
+	return ref, nil
+}
+
+func parseSpec(b []byte) (*specDocument, map[string]map[string]FieldSchema, error) {
+	var doc specDocument
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrSpec, err)
+	}
+	schemas := doc.Components.Schemas
+
+	out := make(map[string]map[string]FieldSchema, len(schemas))
+	for name, s := range schemas {
+		if s.Type != "object" {
+			continue
+		}
+
+		fields := make(map[string]FieldSchema, len(s.Properties))
+		for field, p := range s.Properties {
+			p, err := doc.resolve(p)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s.%s: %w", name, field, err)
+			}
+
+			fs := FieldSchema{Type: p.Type, Format: p.Format}
+			for _, v := range p.Enum {
+				// A blank enum entry stands for null, which is always allowed.
+				if v != nil && *v != "" {
+					fs.Enum = append(fs.Enum, *v)
+				}
+			}
+			sort.Strings(fs.Enum)
+			fields[field] = fs
+		}
+		out[name] = fields
+	}
+
+	return &doc, out, nil
+}
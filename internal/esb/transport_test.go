@@ -0,0 +1,162 @@
+package esb
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-esb-store/internal/esb/esbtest"
+)
+
+// clientCert issues a client certificate signed by a new CA and writes the
+// certificate and key to dir as PEM. It returns the CA pool and the paths.
+func clientCert(t *testing.T, dir string) (*x509.CertPool, string, string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "esbtest client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "go-esb-store"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool, certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCAs, certFile, keyFile := clientCert(t, dir)
+
+	srv := esbtest.NewTLSServer(esbtest.Stores("RUS", 1, 30), clientCAs)
+	defer srv.Close()
+	caFile, err := srv.CAFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		vars map[string]string
+		ok   bool
+	}{
+		{
+			name: "CA and client certificate",
+			vars: map[string]string{"ESB_CA_FILE": caFile, "ESB_CLIENT_CERT_FILE": certFile, "ESB_CLIENT_KEY_FILE": keyFile},
+			ok:   true,
+		},
+		{name: "no CA", vars: map[string]string{"ESB_CLIENT_CERT_FILE": certFile, "ESB_CLIENT_KEY_FILE": keyFile}},
+		{name: "no client certificate", vars: map[string]string{"ESB_CA_FILE": caFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.vars["ESB_BASE_URL"] = srv.URL
+			tt.vars["ESB_API_KEY"] = "key"
+			tt.vars["ESB_RETRY_ATTEMPTS"] = "1"
+
+			c, err := NewESBClient(testConfig(t, tt.vars), nil)
+			if err != nil {
+				t.Fatalf("NewESBClient() error = %v", err)
+			}
+
+			stores, err := c.GetStores(context.Background())
+			if tt.ok && (err != nil || len(stores) != 30) {
+				t.Errorf("GetStores() = %d stores, error %v, want 30 stores", len(stores), err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("GetStores() error = nil, want a TLS error")
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 10))
+	defer srv.Close()
+	srv.Inject(esbtest.Fault{Latency: 2 * time.Second})
+
+	c, err := NewESBClient(testConfig(t, map[string]string{
+		"ESB_BASE_URL":       srv.URL,
+		"ESB_API_KEY":        "key",
+		"ESB_TIMEOUT":        "100ms",
+		"ESB_RETRY_ATTEMPTS": "1",
+	}), nil)
+	if err != nil {
+		t.Fatalf("NewESBClient() error = %v", err)
+	}
+
+	start := time.Now()
+	if _, err = c.GetStores(context.Background()); err == nil {
+		t.Fatal("GetStores() error = nil, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetStores() gave up after %s, want about ESB_TIMEOUT", elapsed)
+	}
+}
+
+func TestInvalidClientCertificate(t *testing.T) {
+	_, err := NewESBClient(testConfig(t, map[string]string{
+		"ESB_BASE_URL":         "https://esb.example",
+		"ESB_API_KEY":          "key",
+		"ESB_CLIENT_CERT_FILE": filepath.Join(t.TempDir(), "missing.pem"),
+	}), nil)
+	if !errors.Is(err, ErrTransport) {
+		t.Errorf("NewESBClient() error = %v, want %v", err, ErrTransport)
+	}
+}
@@ -0,0 +1,247 @@
+package esb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go-esb-store/internal/utils"
+)
+
+const (
+	operationGetStores      = "getStores"
+	operationGetStoresCount = "getStoresCount"
+)
+
+// maxSnippet bounds how much of an offending body ends up in an error.
+const maxSnippet = 64
+
+// ValidationError is an ESB response that does not match api.yaml. The
+// message names the page, or "count" for the $count request, so it stands
+// on its own when logged before the pager wraps it.
+type ValidationError struct {
+	Operation string
+	// Page is the store page of the response, or -1 for other requests.
+	Page   int
+	Status int
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	page := "count"
+	if e.Page >= 0 {
+		page = fmt.Sprintf("page %d", e.Page)
+	}
+	return fmt.Sprintf("%s: %s %s (status %d): %s", ErrInvalidResponse, e.Operation, page, e.Status, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidResponse
+}
+
+// Validator checks ESB responses against the embedded api.yaml before they
+// are decoded: the status must be described for the operation, the content
+// type must be one of the described ones, and the body must have the
+// described shape. Unknown fields, null values and enum values are left to
+// the drift detector, so ESB additions do not fail a sync.
+type Validator struct {
+	doc        *specDocument
+	operations map[string]*specOperation
+}
+
+// NewValidator returns a validator for the embedded api.yaml.
+func NewValidator() (*Validator, error) {
+	doc, _, err := loadSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	operations := make(map[string]*specOperation)
+	for _, methods := range doc.Paths {
+		for _, op := range methods {
+			operations[op.OperationID] = op
+		}
+	}
+
+	return &Validator{
+		doc:        doc,
+		operations: operations,
+	}, nil
+}
+
+// Validate checks the response of operation. Page is the store page number
+// or -1. A nil validator accepts everything.
+func (v *Validator) Validate(operation string, page int, res *http.Response, body []byte) error {
+	if v == nil {
+		return nil
+	}
+
+	if reason := v.validate(operation, res, body); reason != "" {
+		return &ValidationError{
+			Operation: operation,
+			Page:      page,
+			Status:    res.StatusCode,
+			Reason:    reason,
+		}
+	}
+	return nil
+}
+
+func (v *Validator) validate(operation string, res *http.Response, body []byte) string {
+	op, ok := v.operations[operation]
+	if !ok {
+		return fmt.Sprintf("operation %q is not described", operation)
+	}
+
+	spec, ok := op.Responses[strconv.Itoa(res.StatusCode)]
+	if !ok {
+		spec, ok = op.Responses["default"]
+	}
+	if !ok {
+		return fmt.Sprintf("status is not described: %s", snippet(body))
+	}
+	if len(spec.Content) == 0 {
+		return ""
+	}
+
+	header := res.Header.Get("Content-Type")
+	if header == "" {
+		return "missing content type"
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return fmt.Sprintf("invalid content type %q", header)
+	}
+	content, ok := spec.Content[mediaType]
+	if !ok {
+		return fmt.Sprintf("unexpected content type %q: %s", mediaType, snippet(body))
+	}
+
+	schema, err := v.doc.resolve(content.Schema)
+	if err != nil {
+		return err.Error()
+	}
+	if schema == nil {
+		return ""
+	}
+
+	if mediaType == "text/plain" {
+		return v.checkText(schema, body)
+	}
+	return v.checkJSON(schema, body)
+}
+
+// checkText checks a plain text scalar, such as the $count result, which
+// ESB prefixes with a byte order mark.
+func (v *Validator) checkText(schema *specSchema, body []byte) string {
+	s := utils.CleanString(string(body))
+
+	switch schema.Type {
+	case "integer":
+		bits := 64
+		if schema.Format == "int32" {
+			bits = 32
+		}
+		if _, err := strconv.ParseInt(s, 10, bits); err != nil {
+			return fmt.Sprintf("body: expected %s, got %s", schemaType(schema), snippet([]byte(s)))
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return fmt.Sprintf("body: expected number, got %s", snippet([]byte(s)))
+		}
+	}
+	return ""
+}
+
+func (v *Validator) checkJSON(schema *specSchema, body []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		var syntaxErr *json.SyntaxError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return fmt.Sprintf("malformed JSON at offset %d: %s", syntaxErr.Offset, syntaxErr)
+		case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+			return fmt.Sprintf("truncated JSON after %d bytes", len(body))
+		default:
+			return fmt.Sprintf("malformed JSON: %s", err)
+		}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Sprintf("trailing data after JSON at offset %d", dec.InputOffset())
+	}
+
+	return v.check(schema, value, "body")
+}
+
+// check matches a decoded JSON value against schema and returns why it
+// does not match, naming the offending path like value[3].StoreArea.
+func (v *Validator) check(schema *specSchema, value any, path string) string {
+	schema, err := v.doc.resolve(schema)
+	if err != nil {
+		return fmt.Sprintf("%s: %s", path, err)
+	}
+	if schema == nil || value == nil {
+		return ""
+	}
+
+	got := jsonType(value)
+	if !typeMatches(schema.Type, got) {
+		return fmt.Sprintf("%s: expected %s, got %s", path, schemaType(schema), got)
+	}
+
+	switch schema.Type {
+	case "integer":
+		if schema.Format == "int32" {
+			if _, err := strconv.ParseInt(value.(json.Number).String(), 10, 32); err != nil {
+				return fmt.Sprintf("%s: %s out of int32 range", path, value)
+			}
+		}
+	case "object":
+		obj := value.(map[string]any)
+		for _, name := range slices.Sorted(maps.Keys(schema.Properties)) {
+			if reason := v.check(schema.Properties[name], obj[name], fieldPath(path, name)); reason != "" {
+				return reason
+			}
+		}
+	case "array":
+		for i, item := range value.([]any) {
+			if reason := v.check(schema.Items, item, fmt.Sprintf("%s[%d]", path, i)); reason != "" {
+				return reason
+			}
+		}
+	}
+	return ""
+}
+
+func fieldPath(path, name string) string {
+	if path == "body" {
+		return name
+	}
+	return path + "." + name
+}
+
+func schemaType(s *specSchema) string {
+	if s.Format != "" {
+		return s.Type + " (" + s.Format + ")"
+	}
+	return s.Type
+}
+
+func snippet(body []byte) string {
+	s := []rune(strings.Join(strings.Fields(string(body)), " "))
+	if len(s) > maxSnippet {
+		return strconv.Quote(string(s[:maxSnippet]) + "...")
+	}
+	return strconv.Quote(string(s))
+}
@@ -0,0 +1,62 @@
+package esb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go-esb-store/internal/esb/esbtest"
+)
+
+func TestValidationErrorNamesPage(t *testing.T) {
+	tests := []struct {
+		err  *ValidationError
+		want string
+	}{
+		{
+			err:  &ValidationError{Operation: operationGetStores, Page: 3, Status: http.StatusOK, Reason: "missing content type"},
+			want: "response does not match api spec: getStores page 3 (status 200): missing content type",
+		},
+		{
+			err:  &ValidationError{Operation: operationGetStores, Page: 0, Status: http.StatusOK, Reason: "missing content type"},
+			want: "response does not match api spec: getStores page 0 (status 200): missing content type",
+		},
+		{
+			err:  &ValidationError{Operation: operationGetStoresCount, Page: -1, Status: http.StatusBadGateway, Reason: "status is not described"},
+			want: "response does not match api spec: getStoresCount count (status 502): status is not described",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestValidateStorePage(t *testing.T) {
+	srv := esbtest.NewServer(esbtest.Stores("RUS", 1, 250))
+	defer srv.Close()
+	srv.Inject(esbtest.Fault{Match: esbtest.OnPage(200), Body: "<html>Bad gateway</html>", ContentType: "text/html"})
+
+	c, err := NewESBClient(testConfig(t, map[string]string{
+		"ESB_BASE_URL":       srv.URL,
+		"ESB_API_KEY":        "key",
+		"ESB_VALIDATE":       "true",
+		"ESB_RETRY_ATTEMPTS": "1",
+	}), nil)
+	if err != nil {
+		t.Fatalf("NewESBClient() error = %v", err)
+	}
+
+	_, err = c.GetStores(context.Background())
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("GetStores() error = %v, want a *ValidationError", err)
+	}
+	if validationErr.Page != 2 || !strings.Contains(validationErr.Error(), "page 2") {
+		t.Errorf("ValidationError = %q, want page 2", validationErr)
+	}
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type Mode string
 
 const (
@@ -19,14 +21,109 @@ const (
 	Undefined    Status = "Undefined"
 )
 
+// Store is a synced store. Its region and city are AddressRegion and
+// AddressCity, parsed from Address and normalized; ESBRegion and ESBCity
+// are the AddressState and AddressCity of ESB as sent, often empty or
+// spelled differently, and are only kept to check the parsed ones against.
 type Store struct {
-	Number          int
-	Name            string
-	Address         string
-	Mall            string
-	Franchise       string
-	Brand           string
-	Format          string
-	Status          Status
-	TemporaryClosed bool
+	Number            int
+	Name              string
+	Address           string
+	NormalizedAddress string
+	PostalCode        string
+	AddressRegion     string
+	AddressCity       string
+	Street            string
+	House             string
+	Country           string
+	Mall              string
+	Franchise         string
+	Brand             string
+	Format            string
+	Status            Status
+	TemporaryClosed   bool
+	ClosedReason      string
+	OpeningDate       *time.Time
+	ClosingDate       *time.Time
+	Latitude          *float64
+	Longitude         *float64
+	ESBRegion         string
+	ESBCity           string
+	Phone             string
+	Area              *float64
+	SyncedAt          time.Time
+}
+
+// StoreKey identifies a store: store numbers are only unique within a
+// country.
+type StoreKey struct {
+	Country string
+	Number  int
+}
+
+type SyncMode string
+
+const (
+	FullSync  SyncMode = "full"
+	DeltaSync SyncMode = "delta"
+)
+
+// DuplicatePolicy decides which of the ESB records sharing a store number
+// is synced.
+type DuplicatePolicy string
+
+const (
+	// PreferOpen keeps the Open record, then the most complete one.
+	PreferOpen DuplicatePolicy = "open"
+	// PreferComplete keeps the record with the most fields filled in.
+	PreferComplete DuplicatePolicy = "complete"
+	// FailOnDuplicate keeps the first record and fails the run.
+	FailOnDuplicate DuplicatePolicy = "fail"
+)
+
+// SyncState is what a sync remembers between runs: the ESB modification
+// watermark for delta runs and when the last full run finished.
+type SyncState struct {
+	Name       string
+	Watermark  time.Time
+	FullSyncAt time.Time
+}
+
+// Rejection is an ESB record dropped during conversion. Entity names the
+// sync, "stores" for stores; Number is the store number as ESB sent it, or
+// the key of an entity record, empty if missing; Rule is the failed rule;
+// Value is the raw value of the checked field, nil if the field was
+// missing.
+type Rejection struct {
+	Entity string
+	Number string
+	Rule   string
+	Field  string
+	Value  *string
+	// Record is the raw record as JSON.
+	Record string
+}
+
+// DictionaryEntry is a code of a reference dictionary, such as a brand or a
+// store format, with its display name. SortOrder orders entries for display.
+type DictionaryEntry struct {
+	Code      string
+	Name      string
+	Active    bool
+	SortOrder int
+}
+
+// StoreView is a store as read back from YDB, with the display names of its
+// brand and format codes; a name is empty if the code is not in its
+// dictionary.
+type StoreView struct {
+	Number     int
+	Name       string
+	Address    string
+	Country    string
+	Status     Status
+	Brand      string
+	BrandName  string
+	Format     string
+	FormatName string
 }
@@ -28,6 +28,10 @@ func ParseTimeString(s string) (time.Time, error) {
 	if t, err := time.Parse("2006-01-02 15:04:05", s); err == nil {
 		return t, nil
 	}
+	// "2006-01-02"
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
 	// epoch seconds
 	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
 		return time.Unix(sec, 0), nil
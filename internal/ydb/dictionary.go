@@ -0,0 +1,110 @@
+package ydb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
+
+	"go-esb-store/internal/model"
+	"go-esb-store/pkg/logger"
+)
+
+// Dictionary is a reference table of the codes ESB stores refer to. Its
+// value is the default table name, resolved through YDB_TABLES_MAP.
+type Dictionary string
+
+const (
+	Brands  Dictionary = "brands"
+	Formats Dictionary = "formats"
+)
+
+// SeedDictionary inserts the entries whose code is not in the dictionary
+// yet. Entries already there are maintained in YDB and left alone.
+func (c *Client) SeedDictionary(ctx context.Context, d Dictionary, entries []model.DictionaryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	seed := make([]string, 0, len(entries))
+	for _, e := range entries {
+		seed = append(seed, fmt.Sprintf(
+			"AsStruct(Utf8(%s) as code, Utf8(%s) as name, %t as active, Int64(%q) as sort_order)",
+			quoteYQL(e.Code),
+			quoteYQL(e.Name),
+			e.Active,
+			strconv.Itoa(e.SortOrder),
+		))
+	}
+
+	tableName := c.tableName(string(d))
+	query := fmt.Sprintf(`$seed = AsList(
+    %s
+);
+
+upsert into %s (code, name, active, sort_order)
+select s.code as code, s.name as name, s.active as active, s.sort_order as sort_order
+from as_table($seed) as s
+left only join %s as d on s.code = d.code;`, strings.Join(seed, ",\n    "), tableName, tableName)
+
+	if err := c.exec(ctx, query, nil); err != nil {
+		logger.Error("ydb.SeedDictionary: failed to seed dictionary", "error", err, "dictionary", d)
+		return err
+	}
+
+	return nil
+}
+
+// GetDictionary returns the entries of a dictionary by code.
+func (c *Client) GetDictionary(ctx context.Context, d Dictionary) (map[string]model.DictionaryEntry, error) {
+	query := fmt.Sprintf("select code, name, active, sort_order from %s;", c.tableName(string(d)))
+
+	entries := make(map[string]model.DictionaryEntry)
+	err := c.query(ctx, query, nil, func(res result.Result) error {
+		for res.NextResultSet(ctx) {
+			for res.NextRow() {
+				var (
+					e         model.DictionaryEntry
+					sortOrder int64
+				)
+				if err := res.ScanNamed(
+					named.OptionalWithDefault("code", &e.Code),
+					named.OptionalWithDefault("name", &e.Name),
+					named.OptionalWithDefault("active", &e.Active),
+					named.OptionalWithDefault("sort_order", &sortOrder),
+				); err != nil {
+					return err
+				}
+				e.SortOrder = int(sortOrder)
+				entries[e.Code] = e
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("ydb.GetDictionary: failed to get dictionary", "error", err, "dictionary", d)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (c *Client) createDictionary(ctx context.Context, d Dictionary) error {
+	query := fmt.Sprintf(`create table if not exists %s (
+	    code Utf8,
+	    name Utf8,
+	    active Bool,
+	    sort_order Int64,
+	    primary key (code)
+	);`, c.tableName(string(d)))
+
+	if err := c.execScheme(ctx, query); err != nil {
+		logger.Error("ydb.initTables: failed to init tables", "error", err, "dictionary", d)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,6 @@
+package ydb
+
+import "errors"
+
+var ErrInvalidTable = errors.New("invalid table definition")
+var ErrColumnValue = errors.New("unsupported column value")
@@ -0,0 +1,74 @@
+package ydb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-esb-store/internal/model"
+	"go-esb-store/pkg/logger"
+)
+
+// rejection is a model.Rejection with its position among the rejections of
+// its entity in the run, which keys the row together with the run start and
+// the entity.
+type rejection struct {
+	seq int
+	model.Rejection
+}
+
+// SetRejections saves the records of one entity rejected by the run
+// started at runAt.
+func (c *Client) SetRejections(ctx context.Context, runAt time.Time, rejections []model.Rejection) error {
+	rows := make([]rejection, 0, len(rejections))
+	for i, r := range rejections {
+		rows = append(rows, rejection{seq: i, Rejection: r})
+	}
+
+	return upsertBatches(ctx, c.batchSize, rows, func(ctx context.Context, batch []rejection) error {
+		return c.setRejections(ctx, runAt, batch)
+	})
+}
+
+func (c *Client) setRejections(ctx context.Context, runAt time.Time, rejections []rejection) error {
+	if len(rejections) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "upsert into %s (run_at, entity, seq, number, rule, field, value, record) values\n", c.tableName(rejectedStoresTableNameDefault))
+
+	for i, r := range rejections {
+		fmt.Fprintf(&b,
+			"(%s,%s,%d,%s,%s,%s,%s,%s)",
+			timestampYQL(runAt),
+			quoteYQL(r.Entity),
+			r.seq,
+			quoteYQL(r.Number),
+			quoteYQL(r.Rule),
+			quoteYQL(r.Field),
+			utf8YQL(r.Value),
+			quoteYQL(r.Record),
+		)
+
+		if i < len(rejections)-1 {
+			b.WriteString(",\n")
+		}
+	}
+	b.WriteString(";")
+
+	if err := c.exec(ctx, b.String(), nil); err != nil {
+		logger.Error("ydb.SetRejections: failed to store rejections", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func utf8YQL(s *string) string {
+	if s == nil {
+		return "Nothing(Utf8?)"
+	}
+	return fmt.Sprintf("Just(Utf8(%s))", quoteYQL(*s))
+}
@@ -0,0 +1,104 @@
+package ydb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
+
+	"go-esb-store/internal/model"
+	"go-esb-store/pkg/logger"
+)
+
+// GetSyncState returns the state saved for name, or a zero state with that
+// name if none was saved yet.
+func (c *Client) GetSyncState(ctx context.Context, name string) (*model.SyncState, error) {
+	query := fmt.Sprintf(
+		"select watermark, full_sync_at from %s where name = %s;",
+		c.tableName(syncStateTableNameDefault),
+		quoteYQL(name),
+	)
+
+	state := &model.SyncState{Name: name}
+	err := c.query(ctx, query, nil, func(res result.Result) error {
+		for res.NextResultSet(ctx) {
+			for res.NextRow() {
+				if err := res.ScanNamed(
+					named.OptionalWithDefault("watermark", &state.Watermark),
+					named.OptionalWithDefault("full_sync_at", &state.FullSyncAt),
+				); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("ydb.GetSyncState: failed to get sync state", "error", err, "name", name)
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (c *Client) SetSyncState(ctx context.Context, state *model.SyncState) error {
+	query := fmt.Sprintf(
+		"upsert into %s (name, watermark, full_sync_at, updated_at) values (%s,%s,%s,%s);",
+		c.tableName(syncStateTableNameDefault),
+		quoteYQL(state.Name),
+		timestampYQL(state.Watermark),
+		timestampYQL(state.FullSyncAt),
+		timestampYQL(time.Now()),
+	)
+
+	if err := c.exec(ctx, query, nil); err != nil {
+		logger.Error("ydb.SetSyncState: failed to set sync state", "error", err, "name", state.Name)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteStoresNotSyncedSince deletes stores of the given countries that a
+// full sync started at since did not touch, i.e. stores gone from ESB,
+// except the keep ones, e.g. stores ESB sent but the sync rejected. Rows
+// without synced_at predate the column and are left alone.
+func (c *Client) DeleteStoresNotSyncedSince(ctx context.Context, since time.Time, countries []string, keep []model.StoreKey) error {
+	var b strings.Builder
+	fmt.Fprintf(&b,
+		"delete from %s where synced_at < %s",
+		c.tableName(storesTableNameDefault),
+		timestampYQL(since),
+	)
+	if len(countries) > 0 {
+		quoted := make([]string, 0, len(countries))
+		for _, country := range countries {
+			quoted = append(quoted, quoteYQL(country))
+		}
+		fmt.Fprintf(&b, " and country in (%s)", strings.Join(quoted, ","))
+	}
+
+	byCountry := make(map[string][]string)
+	var order []string
+	for _, k := range keep {
+		if _, ok := byCountry[k.Country]; !ok {
+			order = append(order, k.Country)
+		}
+		byCountry[k.Country] = append(byCountry[k.Country], strconv.Itoa(k.Number))
+	}
+	for _, country := range order {
+		fmt.Fprintf(&b, " and not (country = %s and number in (%s))", quoteYQL(country), strings.Join(byCountry[country], ","))
+	}
+	b.WriteString(";")
+
+	if err := c.exec(ctx, b.String(), nil); err != nil {
+		logger.Error("ydb.DeleteStoresNotSyncedSince: failed to delete stale stores", "error", err, "kept", len(keep))
+		return err
+	}
+
+	return nil
+}
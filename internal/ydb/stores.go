@@ -0,0 +1,90 @@
+package ydb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
+
+	"go-esb-store/internal/model"
+	"go-esb-store/pkg/logger"
+)
+
+// GetStores reads the stores of the given countries, or all of them, with
+// the display names of their brand and format joined from the dictionaries.
+func (c *Client) GetStores(ctx context.Context, countries ...string) ([]model.StoreView, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, `select
+    s.number as number, s.name as name, s.address as address, s.country as country, s.status as status,
+    s.brand as brand, b.name as brand_name, s.format as format, f.name as format_name
+from %s as s
+left join %s as b on s.brand = b.code
+left join %s as f on s.format = f.code`,
+		c.tableName(storesTableNameDefault),
+		c.tableName(string(Brands)),
+		c.tableName(string(Formats)),
+	)
+	if len(countries) > 0 {
+		quoted := make([]string, 0, len(countries))
+		for _, country := range countries {
+			quoted = append(quoted, quoteYQL(country))
+		}
+		fmt.Fprintf(&b, "\nwhere s.country in (%s)", strings.Join(quoted, ","))
+	}
+	b.WriteString("\norder by country, number;")
+
+	var stores []model.StoreView
+	err := c.scanQuery(ctx, b.String(), func(res result.StreamResult) error {
+		for res.NextResultSet(ctx) {
+			for res.NextRow() {
+				var (
+					s      model.StoreView
+					number int64
+					status string
+				)
+				if err := res.ScanNamed(
+					named.OptionalWithDefault("number", &number),
+					named.OptionalWithDefault("name", &s.Name),
+					named.OptionalWithDefault("address", &s.Address),
+					named.OptionalWithDefault("country", &s.Country),
+					named.OptionalWithDefault("status", &status),
+					named.OptionalWithDefault("brand", &s.Brand),
+					named.OptionalWithDefault("brand_name", &s.BrandName),
+					named.OptionalWithDefault("format", &s.Format),
+					named.OptionalWithDefault("format_name", &s.FormatName),
+				); err != nil {
+					return err
+				}
+				s.Number, s.Status = int(number), model.Status(status)
+				stores = append(stores, s)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("ydb.GetStores: failed to get stores", "error", err, "countries", countries)
+		return nil, err
+	}
+
+	return stores, nil
+}
+
+// scanQuery runs a read-only query as a scan query, which streams results
+// past the row limit of data queries.
+func (c *Client) scanQuery(ctx context.Context, query string, scan func(res result.StreamResult) error) error {
+	return c.driver.Table().Do(ctx, func(ctx context.Context, s table.Session) error {
+		res, err := s.StreamExecuteScanQuery(ctx, query, nil)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = res.Close() }()
+
+		if err = scan(res); err != nil {
+			return err
+		}
+		return res.Err()
+	})
+}
@@ -0,0 +1,224 @@
+package ydb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-esb-store/pkg/logger"
+)
+
+// ColumnType is the YDB type of a column of a generic table.
+type ColumnType string
+
+const (
+	Utf8      ColumnType = "Utf8"
+	Int64     ColumnType = "Int64"
+	Double    ColumnType = "Double"
+	Bool      ColumnType = "Bool"
+	Date      ColumnType = "Date"
+	Timestamp ColumnType = "Timestamp"
+)
+
+// SyncedAtColumn is the column DeleteRowsNotSyncedSince looks at.
+const SyncedAtColumn = "synced_at"
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Table describes a table written by a generic entity sync. Name is
+// resolved through YDB_TABLES_MAP like the stores table.
+type Table struct {
+	Name    string
+	Columns []Column
+	Key     []string
+}
+
+// Row holds the values of a table row by column name: string for Utf8,
+// int64 for Int64, float64 for Double, bool for Bool and time.Time for Date
+// and Timestamp. Missing and nil values are stored as NULL.
+type Row map[string]any
+
+// Validate checks that the table has columns of known types and a primary
+// key made of its columns.
+func (t *Table) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("%w: no name", ErrInvalidTable)
+	}
+	if len(t.Columns) == 0 {
+		return fmt.Errorf("%w: %s: no columns", ErrInvalidTable, t.Name)
+	}
+	if len(t.Key) == 0 {
+		return fmt.Errorf("%w: %s: no primary key", ErrInvalidTable, t.Name)
+	}
+
+	names := make(map[string]struct{}, len(t.Columns))
+	for _, col := range t.Columns {
+		switch col.Type {
+		case Utf8, Int64, Double, Bool, Date, Timestamp:
+		default:
+			return fmt.Errorf("%w: %s.%s: unsupported type %q", ErrInvalidTable, t.Name, col.Name, col.Type)
+		}
+		if _, ok := names[col.Name]; ok || col.Name == "" {
+			return fmt.Errorf("%w: %s: invalid or repeated column %q", ErrInvalidTable, t.Name, col.Name)
+		}
+		names[col.Name] = struct{}{}
+	}
+	for _, key := range t.Key {
+		if _, ok := names[key]; !ok {
+			return fmt.Errorf("%w: %s: key column %q is not a column", ErrInvalidTable, t.Name, key)
+		}
+	}
+
+	return nil
+}
+
+// UpsertRows upserts rows into t in concurrent batches, like SetStores.
+func (c *Client) UpsertRows(ctx context.Context, t *Table, rows []Row) error {
+	return upsertBatches(ctx, c.batchSize, rows, func(ctx context.Context, batch []Row) error {
+		return c.upsertRows(ctx, t, batch)
+	})
+}
+
+func (c *Client) upsertRows(ctx context.Context, t *Table, rows []Row) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(t.Columns))
+	for _, col := range t.Columns {
+		names = append(names, col.Name)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "upsert into %s (%s) values\n", c.tableName(t.Name), strings.Join(names, ", "))
+
+	for i, row := range rows {
+		values := make([]string, 0, len(t.Columns))
+		for _, col := range t.Columns {
+			v, err := valueYQL(col.Type, row[col.Name])
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", t.Name, col.Name, err)
+			}
+			values = append(values, v)
+		}
+		b.WriteString("(" + strings.Join(values, ",") + ")")
+
+		if i < len(rows)-1 {
+			b.WriteString(",\n")
+		}
+	}
+	b.WriteString(";")
+
+	if err := c.exec(ctx, b.String(), nil); err != nil {
+		logger.Error("ydb.UpsertRows: failed to upsert rows", "error", err, "table", t.Name)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteRowsNotSyncedSince deletes the rows of t that a full sync started
+// at since did not touch, except the keep ones, given by the values of
+// their key columns, e.g. records ESB sent but the sync rejected. The table
+// must have a SyncedAtColumn.
+func (c *Client) DeleteRowsNotSyncedSince(ctx context.Context, t *Table, since time.Time, keep []Row) error {
+	if !slices.ContainsFunc(t.Columns, func(col Column) bool { return col.Name == SyncedAtColumn }) {
+		return fmt.Errorf("%w: %s: no %s column", ErrInvalidTable, t.Name, SyncedAtColumn)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b,
+		"delete from %s where %s < %s",
+		c.tableName(t.Name),
+		SyncedAtColumn,
+		timestampYQL(since),
+	)
+	for _, row := range keep {
+		key, err := t.keyYQL(row)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, " and not (%s)", key)
+	}
+	b.WriteString(";")
+
+	if err := c.exec(ctx, b.String(), nil); err != nil {
+		logger.Error("ydb.DeleteRowsNotSyncedSince: failed to delete stale rows", "error", err, "table", t.Name, "kept", len(keep))
+		return err
+	}
+
+	return nil
+}
+
+// keyYQL renders a predicate matching the row of t with the key of row.
+func (t *Table) keyYQL(row Row) (string, error) {
+	parts := make([]string, 0, len(t.Key))
+	for _, key := range t.Key {
+		i := slices.IndexFunc(t.Columns, func(col Column) bool { return col.Name == key })
+		v, err := valueYQL(t.Columns[i].Type, row[key])
+		if err != nil || row[key] == nil {
+			return "", fmt.Errorf("%w: %s.%s: invalid key value %v", ErrColumnValue, t.Name, key, row[key])
+		}
+		parts = append(parts, key+" = "+v)
+	}
+	return strings.Join(parts, " and "), nil
+}
+
+func (c *Client) createTable(ctx context.Context, t *Table) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "create table if not exists %s (\n", c.tableName(t.Name))
+	for _, col := range t.Columns {
+		fmt.Fprintf(&b, "    %s %s,\n", col.Name, col.Type)
+	}
+	fmt.Fprintf(&b, "    primary key (%s)\n);", strings.Join(t.Key, ", "))
+
+	if err := c.execScheme(ctx, b.String()); err != nil {
+		logger.Error("ydb.createTable: failed to create table", "error", err, "table", t.Name)
+		return err
+	}
+
+	return nil
+}
+
+// valueYQL renders an optional literal of type t. Every value is rendered
+// as an optional, so NULL and non-NULL rows of a batch have the same type.
+func valueYQL(t ColumnType, v any) (string, error) {
+	if v == nil {
+		return fmt.Sprintf("Nothing(%s?)", t), nil
+	}
+
+	switch t {
+	case Utf8:
+		if s, ok := v.(string); ok {
+			return fmt.Sprintf("Just(Utf8(%s))", quoteYQL(s)), nil
+		}
+	case Int64:
+		if n, ok := v.(int64); ok {
+			return fmt.Sprintf("Just(Int64(%q))", strconv.FormatInt(n, 10)), nil
+		}
+	case Double:
+		if f, ok := v.(float64); ok {
+			return doubleYQL(&f), nil
+		}
+	case Bool:
+		if ok, isBool := v.(bool); isBool {
+			return fmt.Sprintf("Just(%t)", ok), nil
+		}
+	case Date:
+		if d, ok := v.(time.Time); ok {
+			return dateYQL(&d), nil
+		}
+	case Timestamp:
+		if ts, ok := v.(time.Time); ok {
+			return timestampYQL(ts), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %T for %s", ErrColumnValue, v, t)
+}
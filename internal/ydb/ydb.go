@@ -3,11 +3,14 @@ package ydb
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ydb-platform/ydb-go-sdk/v3"
 	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result"
 	ycdev "github.com/ydb-platform/ydb-go-yc"
 	ycprod "github.com/ydb-platform/ydb-go-yc-metadata"
 
@@ -17,8 +20,10 @@ import (
 )
 
 const (
-	defaultBatchSize       = 500
-	storesTableNameDefault = "stores"
+	defaultBatchSize               = 500
+	storesTableNameDefault         = "stores"
+	syncStateTableNameDefault      = "sync_state"
+	rejectedStoresTableNameDefault = "rejected_stores"
 )
 
 type Client struct {
@@ -28,7 +33,10 @@ type Client struct {
 	batchSize    int
 }
 
-func NewYDBClient(ctx context.Context, cfg *config.YDB) (*Client, error) {
+// NewYDBClient connects to YDB. In dev mode it creates the stores, sync
+// state, rejected stores and dictionary tables and the given tables of
+// generic entity syncs.
+func NewYDBClient(ctx context.Context, cfg *config.YDB, tables ...*Table) (*Client, error) {
 	creds, ca, err := initCreds(cfg.Mode, cfg.CredsFile)
 	if err != nil {
 		return nil, err
@@ -56,7 +64,7 @@ func NewYDBClient(ctx context.Context, cfg *config.YDB) (*Client, error) {
 	}
 
 	if cfg.Mode == model.Dev {
-		if err = c.initTables(ctx); err != nil {
+		if err = c.initTables(ctx, tables); err != nil {
 			return nil, err
 		}
 		logger.Debug("app.New: table created", "table", c.databaseName)
@@ -70,11 +78,16 @@ func (c *Client) Close(ctx context.Context) error {
 }
 
 func (c *Client) SetStores(ctx context.Context, stores []model.Store) error {
-	if len(stores) == 0 {
+	return upsertBatches(ctx, c.batchSize, stores, c.setStores)
+}
+
+// upsertBatches splits items into batches of batchSize and upserts them
+// concurrently with fn. The first failed batch cancels the others.
+func upsertBatches[T any](ctx context.Context, batchSize int, items []T, fn func(ctx context.Context, batch []T) error) error {
+	if len(items) == 0 {
 		return nil
 	}
 
-	batchSize := c.batchSize
 	if batchSize < 1 {
 		batchSize = defaultBatchSize
 	}
@@ -85,18 +98,18 @@ func (c *Client) SetStores(ctx context.Context, stores []model.Store) error {
 	var wg sync.WaitGroup
 	errCh := make(chan error, 1)
 
-	for i := 0; i < len(stores); i += batchSize {
+	for i := 0; i < len(items); i += batchSize {
 		end := i + batchSize
-		if end > len(stores) {
-			end = len(stores)
+		if end > len(items) {
+			end = len(items)
 		}
-		batch := stores[i:end]
+		batch := items[i:end]
 
 		wg.Add(1)
-		go func(b []model.Store) {
+		go func(b []T) {
 			defer wg.Done()
 
-			if err := c.setStores(ctx, b); err != nil {
+			if err := fn(ctx, b); err != nil {
 				select {
 				case errCh <- err:
 					cancel()
@@ -121,27 +134,40 @@ func (c *Client) setStores(ctx context.Context, stores []model.Store) error {
 		return nil
 	}
 
-	var tableName string
-	if v, ok := c.tablesMap[storesTableNameDefault]; !ok {
-		tableName = storesTableNameDefault
-	} else {
-		tableName = v
-	}
+	tableName := c.tableName(storesTableNameDefault)
 
 	var b strings.Builder
-	b.WriteString(fmt.Sprintf("upsert into %s (number, name, address, mall, franchise, brand, format, status) values\n", tableName))
+	b.WriteString(fmt.Sprintf("upsert into %s (number, name, address, normalized_address, postal_code, address_region, address_city, street, house, country, mall, franchise, brand, format, status, temporary_closed, temporary_closed_reason, opening_date, closing_date, latitude, longitude, esb_region, esb_city, phone, area, synced_at) values\n", tableName))
 
 	for i, s := range stores {
 		fmt.Fprintf(&b,
-			"(%d,%s,%s,%s,%s,%s,%s,%s)",
+			"(%d,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%t,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s)",
 			s.Number,
 			quoteYQL(s.Name),
 			quoteYQL(s.Address),
+			quoteYQL(s.NormalizedAddress),
+			quoteYQL(s.PostalCode),
+			quoteYQL(s.AddressRegion),
+			quoteYQL(s.AddressCity),
+			quoteYQL(s.Street),
+			quoteYQL(s.House),
+			quoteYQL(s.Country),
 			quoteYQL(s.Mall),
 			quoteYQL(s.Franchise),
 			quoteYQL(s.Brand),
 			quoteYQL(s.Format),
 			quoteYQL(string(s.Status)),
+			s.TemporaryClosed,
+			quoteYQL(s.ClosedReason),
+			dateYQL(s.OpeningDate),
+			dateYQL(s.ClosingDate),
+			doubleYQL(s.Latitude),
+			doubleYQL(s.Longitude),
+			quoteYQL(s.ESBRegion),
+			quoteYQL(s.ESBCity),
+			quoteYQL(s.Phone),
+			doubleYQL(s.Area),
+			timestampYQL(s.SyncedAt),
 		)
 
 		if i < len(stores)-1 {
@@ -159,6 +185,14 @@ func (c *Client) setStores(ctx context.Context, stores []model.Store) error {
 	return nil
 }
 
+// tableName resolves an app table name through YDB_TABLES_MAP.
+func (c *Client) tableName(name string) string {
+	if v, ok := c.tablesMap[name]; ok {
+		return v
+	}
+	return name
+}
+
 func (c *Client) exec(ctx context.Context, query string, params *table.QueryParameters) error {
 	return c.driver.Table().Do(ctx, func(ctx context.Context, s table.Session) error {
 		_, _, err := s.Execute(ctx, table.DefaultTxControl(), query, params)
@@ -166,32 +200,60 @@ func (c *Client) exec(ctx context.Context, query string, params *table.QueryPara
 	})
 }
 
+func (c *Client) query(ctx context.Context, query string, params *table.QueryParameters, scan func(res result.Result) error) error {
+	return c.driver.Table().Do(ctx, func(ctx context.Context, s table.Session) error {
+		_, res, err := s.Execute(ctx, table.DefaultTxControl(), query, params)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = res.Close() }()
+
+		if err = scan(res); err != nil {
+			return err
+		}
+		return res.Err()
+	})
+}
+
 func (c *Client) execScheme(ctx context.Context, query string) error {
 	return c.driver.Table().Do(ctx, func(ctx context.Context, s table.Session) error {
 		return s.ExecuteSchemeQuery(ctx, query)
 	})
 }
 
-func (c *Client) initTables(ctx context.Context) error {
-	var tableName string
-	if v, ok := c.tablesMap[storesTableNameDefault]; !ok {
-		tableName = storesTableNameDefault
-	} else {
-		tableName = v
-	}
+func (c *Client) initTables(ctx context.Context, tables []*Table) error {
+	tableName := c.tableName(storesTableNameDefault)
 
 	query := fmt.Sprintf(`create table if not exists %s (
 	    number Int64,
 	    name Utf8,
 	    address Utf8,
+	    normalized_address Utf8,
+	    postal_code Utf8,
+	    address_region Utf8,
+	    address_city Utf8,
+	    street Utf8,
+	    house Utf8,
+	    country Utf8,
 	    mall Utf8,
 	    franchise Utf8,
 	    brand Utf8,
 	    format Utf8,
 	    status Utf8,
 	    temporary_closed Bool,
-	    primary key (number),
-	    index idx_stores_name global on (name)
+	    temporary_closed_reason Utf8,
+	    opening_date Date,
+	    closing_date Date,
+	    latitude Double,
+	    longitude Double,
+	    esb_region Utf8,
+	    esb_city Utf8,
+	    phone Utf8,
+	    area Double,
+	    synced_at Timestamp,
+	    primary key (country, number),
+	    index idx_stores_name global on (name),
+	    index idx_stores_country global on (country)
 	);`, tableName)
 
 	if err := c.execScheme(ctx, query); err != nil {
@@ -199,6 +261,48 @@ func (c *Client) initTables(ctx context.Context) error {
 		return err
 	}
 
+	query = fmt.Sprintf(`create table if not exists %s (
+	    name Utf8,
+	    watermark Timestamp,
+	    full_sync_at Timestamp,
+	    updated_at Timestamp,
+	    primary key (name)
+	);`, c.tableName(syncStateTableNameDefault))
+
+	if err := c.execScheme(ctx, query); err != nil {
+		logger.Error("ydb.initTables: failed to init tables", "error", err)
+		return err
+	}
+
+	query = fmt.Sprintf(`create table if not exists %s (
+	    run_at Timestamp,
+	    entity Utf8,
+	    seq Int64,
+	    number Utf8,
+	    rule Utf8,
+	    field Utf8,
+	    value Utf8,
+	    record Utf8,
+	    primary key (run_at, entity, seq)
+	);`, c.tableName(rejectedStoresTableNameDefault))
+
+	if err := c.execScheme(ctx, query); err != nil {
+		logger.Error("ydb.initTables: failed to init tables", "error", err)
+		return err
+	}
+
+	for _, d := range []Dictionary{Brands, Formats} {
+		if err := c.createDictionary(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range tables {
+		if err := c.createTable(ctx, t); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -251,3 +355,26 @@ func quoteYQL(s string) string {
 	b.WriteByte('"')
 	return b.String()
 }
+
+// dateYQL renders an optional Date literal; dates before 1970 are not
+// representable in YDB and are stored as NULL.
+func dateYQL(t *time.Time) string {
+	if t == nil || t.Year() < 1970 {
+		return "Nothing(Date?)"
+	}
+	return fmt.Sprintf("Just(Date(%q))", t.UTC().Format(time.DateOnly))
+}
+
+func doubleYQL(f *float64) string {
+	if f == nil {
+		return "Nothing(Double?)"
+	}
+	return fmt.Sprintf("Just(Double(%q))", strconv.FormatFloat(*f, 'g', -1, 64))
+}
+
+func timestampYQL(t time.Time) string {
+	if t.IsZero() {
+		return "Nothing(Timestamp?)"
+	}
+	return fmt.Sprintf("Just(Timestamp(%q))", t.UTC().Format("2006-01-02T15:04:05.000000Z"))
+}
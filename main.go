@@ -2,12 +2,38 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"log"
+	"os"
 
+	"go-esb-store/internal/app"
+	"go-esb-store/internal/config"
+	"go-esb-store/pkg/logger"
 	"go-esb-store/pkg/trigger"
 )
 
 func main() {
+	record := flag.String("record", "", "record ESB responses of this run to the directory")
+	replay := flag.String("replay", "", "serve ESB responses recorded to the directory instead of calling ESB")
+	seed := flag.Bool("seed-dictionaries", false, "insert the codes of internal/app/dictionaries.yaml missing from the YDB dictionaries instead of syncing")
+	stores := flag.Bool("stores", false, "print the stores of ESB_COUNTRIES with their brand and format names instead of syncing")
+	flag.Parse()
+
+	if *seed || *stores {
+		command(*seed)
+		return
+	}
+
+	switch {
+	case *record != "" && *replay != "":
+		log.Fatalln("-record and -replay are mutually exclusive")
+	case *record != "":
+		setCassette("record", *record)
+	case *replay != "":
+		setCassette("replay", *replay)
+	}
+
 	log.Println("Starting function locally...")
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -22,3 +48,39 @@ func main() {
 	log.Println("Local function finished successfully")
 	log.Println(res)
 }
+
+func setCassette(mode, dir string) {
+	if err := os.Setenv("ESB_CASSETTE_MODE", mode); err != nil {
+		log.Fatalln(err)
+	}
+	if err := os.Setenv("ESB_CASSETTE_DIR", dir); err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("ESB cassette: %s %s\n", mode, dir)
+}
+
+// command seeds the dictionaries, or prints the stores as JSON lines.
+func command(seed bool) {
+	ctx := context.Background()
+	cfg := config.Must()
+	logger.Init(cfg.App.LogLevel)
+
+	if seed {
+		if err := app.SeedDictionaries(ctx, cfg); err != nil {
+			log.Fatalln(err)
+		}
+		log.Println("Dictionaries seeded")
+		return
+	}
+
+	stores, err := app.Stores(ctx, cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, s := range stores {
+		if err = enc.Encode(s); err != nil {
+			log.Fatalln(err)
+		}
+	}
+}